@@ -3,7 +3,8 @@ package yap
 import (
 	"fmt"
 	"math/big"
-	"strconv"
+	"strings"
+	"time"
 )
 
 type Expr interface {
@@ -28,9 +29,33 @@ func (i *Ident) Eval(ctx *EvalContext) (interface{}, error) {
 		return nil, err
 	}
 
-	return path.Resolve(ctx.Json)
+	return resolveIdent(ctx, identKey(path), path)
 }
 
+// identKey is the first segment of an identifier path without its indices,
+// it may refer to a scoped binding, e.g. @ or a lambda parameter
+func identKey(path *Path) string {
+	return IndexedPattern.ReplaceAllString(path.Segments[0].Name, "")
+}
+
+// resolveIdent resolves an identifier path against the binding of key,
+// or relative to the root when key is not bound
+func resolveIdent(ctx *EvalContext, key string, path *Path) (interface{}, error) {
+	if value, exists := ctx.Lookup(key); exists {
+		return ctx.resolve(path.resolveBound(value))
+	}
+
+	if strings.HasPrefix(key, "@") {
+		return nil, fmt.Errorf("%s is not bound in this scope", key)
+	}
+
+	return ctx.resolve(path.Resolve(ctx.Json))
+}
+
+// BinOp applies Operator to Left and Right. Operands are evaluated left to
+// right; && and || short-circuit, so Right is only evaluated when Left
+// does not already decide the result, e.g. in $.user != null && $.user.age > 18
+// == and != compare structurally, see valuesEqual.
 type BinOp struct {
 	Left     Expr
 	Operator string
@@ -41,108 +66,308 @@ func (b *BinOp) Node() Expr {
 	return b
 }
 
-func (b *BinOp) toBigFloat(i interface{}) (*big.Float, bool) {
-	switch x := i.(type) {
-	case *big.Float:
-		return x, true
-	case float64:
-		return big.NewFloat(x), true
-	case int64:
-		return NewFloatFromInt(int(x)), true
+// orderEval evaluates <, >, <= and >= with the ordering of compareOrdered,
+// operands of different types are an error unless comparisons are lenient
+func (b *BinOp) orderEval(ctx *EvalContext, left, right interface{}) (bool, error) {
+	cmp, err := compareOrdered(ctx.Collation, left, right)
+
+	if err != nil {
+		if ctx.Comparison == LenientComparison {
+			return false, nil
+		}
+		return false, err
 	}
 
-	return nil, false
+	switch b.Operator {
+	case "<":
+		return cmp < 0, nil
+	case ">":
+		return cmp > 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">=":
+		return cmp >= 0, nil
+	default:
+		return false, fmt.Errorf("unsupported operator: %s", b.Operator)
+	}
 }
 
-func (b *BinOp) numericEval(left, right interface{}) (bool, error) {
-	lNum, ok := b.toBigFloat(left)
+// shortCircuit evaluates the logical operators, Right is skipped when the
+// result is already known from Left
+func (b *BinOp) shortCircuit(ctx *EvalContext, left interface{}) (interface{}, error) {
+	truthy := toBoolean(left)
+
+	if b.Operator == "||" && truthy {
+		return true, nil
+	}
+
+	if b.Operator == "&&" && !truthy {
+		return false, nil
+	}
+
+	right, err := b.Right.Eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return toBoolean(right), nil
+}
+
+var arithmeticOperators = map[string]struct{}{
+	"+": {},
+	"-": {},
+	"*": {},
+	"/": {},
+}
+
+// arithmeticEval computes numbers with the context precision and rounding,
+// + also concatenates two strings
+func (b *BinOp) arithmeticEval(ctx *EvalContext, left, right interface{}) (interface{}, error) {
+	if lStr, ok := left.(string); ok && b.Operator == "+" {
+		if rStr, ok := right.(string); ok {
+			if err := ctx.checkSize(len(lStr) + len(rStr)); err != nil {
+				return nil, err
+			}
+			return lStr + rStr, nil
+		}
+	}
+
+	if result, ok := nativeArithmetic(ctx, b.Operator, left, right); ok {
+		return result, nil
+	}
+
+	lNum, ok := toBigFloat(left)
 	if !ok {
-		return false, fmt.Errorf("left operand is not a number")
+		return nil, fmt.Errorf("left operand of %s is not a number", b.Operator)
 	}
-	rNum, ok := b.toBigFloat(right)
+	rNum, ok := toBigFloat(right)
 	if !ok {
-		return false, fmt.Errorf("right operand is not a number")
+		return nil, fmt.Errorf("right operand of %s is not a number", b.Operator)
+	}
+
+	result := ctx.newFloat()
+
+	switch b.Operator {
+	case "+":
+		return result.Add(lNum, rNum), nil
+	case "-":
+		return result.Sub(lNum, rNum), nil
+	case "*":
+		return result.Mul(lNum, rNum), nil
+	case "/":
+		if rNum.Sign() == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return result.Quo(lNum, rNum), nil
+	default:
+		return nil, fmt.Errorf("unsupported operator: %s", b.Operator)
+	}
+}
+
+// temporalEval compares or computes with times and durations
+func (b *BinOp) temporalEval(left, right interface{}) (interface{}, error) {
+	if _, ok := arithmeticOperators[b.Operator]; ok {
+		return temporalArithmetic(b.Operator, left, right)
+	}
+
+	cmp, err := temporalCompare(left, right)
+	if err != nil {
+		// values that are not times are simply not equal to one
+		if b.Operator == "==" || b.Operator == "!=" {
+			return b.Operator == "!=", nil
+		}
+		return nil, err
 	}
 
 	switch b.Operator {
 	case "==":
-		return lNum.Cmp(rNum) == 0, nil
+		return cmp == 0, nil
 	case "!=":
-		return lNum.Cmp(rNum) != 0, nil
+		return cmp != 0, nil
 	case "<":
-		return lNum.Cmp(rNum) == -1, nil
+		return cmp < 0, nil
 	case ">":
-		return lNum.Cmp(rNum) == 1, nil
+		return cmp > 0, nil
 	case "<=":
-		return lNum.Cmp(rNum) != 1, nil
+		return cmp <= 0, nil
 	case ">=":
-		return lNum.Cmp(rNum) != -1, nil
+		return cmp >= 0, nil
 	default:
-		return false, fmt.Errorf("unsupported operator: %s", b.Operator)
+		return nil, fmt.Errorf("unsupported operator for times: %s", b.Operator)
+	}
+}
+
+// regexEval matches the left string against the right pattern anywhere in it
+func (b *BinOp) regexEval(left, right interface{}) (bool, error) {
+	str, ok := left.(string)
+	if !ok {
+		return false, fmt.Errorf("left operand of %s is not a string", b.Operator)
+	}
+
+	re, err := toRegexp(b.Right, right)
+	if err != nil {
+		return false, err
 	}
+
+	return re.MatchString(str) == (b.Operator == "=~"), nil
 }
 
-func (b *BinOp) isNumeric(v interface{}) bool {
-	_, ok := v.(*big.Float)
-	return ok
+// isAbsent reports whether a value is null or missing
+func isAbsent(v interface{}) bool {
+	return v == nil || v == Undefined
 }
 
-func (b *BinOp) toBoolean(v interface{}) bool {
-	switch x := v.(type) {
-	case bool:
-		// already truthy
-		return x
-	case string:
-		b, err := strconv.ParseBool(x)
+// lenient returns a copy of ctx where missing paths are Undefined instead
+// of an error, used by operators and functions that test for absence
+func lenient(ctx *EvalContext) *EvalContext {
+	if ctx.MissingKeys == MissingAsUndefined {
+		return ctx
+	}
 
-		if err != nil {
-			return false
-		}
-		return b
-	case int:
-		return x > 0
-	case float64:
-		return x > 0.0
-	case *big.Float:
-		return x.Cmp(big.NewFloat(0)) == 1
+	scope := *ctx
+	scope.MissingKeys = MissingAsUndefined
+
+	return &scope
+}
+
+// coalesce evaluates the ?? operator, Right is only evaluated when Left is
+// null or missing, regardless of the missing key behaviour
+func (b *BinOp) coalesce(ctx *EvalContext) (interface{}, error) {
+	left, err := b.Left.Eval(lenient(ctx))
+	if err != nil {
+		return nil, err
 	}
 
-	return false
+	if !isAbsent(left) {
+		return left, nil
+	}
+
+	return b.Right.Eval(ctx)
 }
 
 func (b *BinOp) Eval(ctx *EvalContext) (interface{}, error) {
+	if b.Operator == "??" {
+		return b.coalesce(ctx)
+	}
+
 	left, err := b.Left.Eval(ctx)
 	if err != nil {
 		return nil, err
 	}
+
+	if b.Operator == "||" || b.Operator == "&&" {
+		return b.shortCircuit(ctx, left)
+	}
+
 	right, err := b.Right.Eval(ctx)
 	if err != nil {
 		return nil, err
 	}
 
+	return b.apply(ctx, left, right)
+}
+
+// apply computes the operators other than ??, && and || from evaluated
+// operands
+func (b *BinOp) apply(ctx *EvalContext, left, right interface{}) (interface{}, error) {
+	// comparisons against a missing value are never true, arithmetic
+	// on it stays missing
+	if left == Undefined || right == Undefined {
+		if _, ok := arithmeticOperators[b.Operator]; ok {
+			return Undefined, nil
+		}
+		return false, nil
+	}
+
+	if isTemporal(left) || isTemporal(right) {
+		return b.temporalEval(left, right)
+	}
+
 	switch b.Operator {
-	case "||":
-		return b.toBoolean(left) || b.toBoolean(right), nil
-	case "&&":
-		return b.toBoolean(left) && b.toBoolean(right), nil
 	case "==":
-		if b.isNumeric(left) && b.isNumeric(right) {
-			return b.numericEval(left, right)
-		}
-		return left == right, nil
+		return valuesEqual(ctx.Collation, left, right), nil
 	case "!=":
-		if b.isNumeric(left) && b.isNumeric(right) {
-			return b.numericEval(left, right)
-		}
-		return left != right, nil
+		return !valuesEqual(ctx.Collation, left, right), nil
 	case "<", ">", "<=", ">=":
-		return b.numericEval(left, right)
+		return b.orderEval(ctx, left, right)
+	case "=~", "!~":
+		return b.regexEval(left, right)
+	case "+", "-", "*", "/":
+		return b.arithmeticEval(ctx, left, right)
 
 	default:
 		return nil, fmt.Errorf("unsupported operator: %s", b.Operator)
 	}
+}
+
+// UnaryOp applies a prefix operator, - negates a number and ! inverts
+// the truthiness of its operand
+type UnaryOp struct {
+	Operator string
+	Operand  Expr
+}
+
+func (u *UnaryOp) Node() Expr {
+	return u
+}
+
+func (u *UnaryOp) Eval(ctx *EvalContext) (interface{}, error) {
+	operand, err := u.Operand.Eval(ctx)
+	if err != nil {
+		return nil, err
+	}
 
-	return nil, fmt.Errorf("invalid operands for operator: %s", b.Operator)
+	return u.apply(ctx, operand)
+}
+
+// apply computes the operator from the evaluated operand
+func (u *UnaryOp) apply(ctx *EvalContext, operand interface{}) (interface{}, error) {
+	switch u.Operator {
+	case "!":
+		return !toBoolean(operand), nil
+	case "-":
+		if operand == Undefined {
+			return Undefined, nil
+		}
+
+		// -0 is left to *big.Float, which keeps the sign of zero
+		if i, wide, ok := nativeInt(operand); ok && i != 0 && ctx.Precision == 0 {
+			return nativeResult(-i, wide), nil
+		}
+
+		num, ok := toBigFloat(operand)
+		if !ok {
+			return nil, fmt.Errorf("operand of - is not a number")
+		}
+		return ctx.newFloat().Neg(num), nil
+	default:
+		return nil, fmt.Errorf("unsupported operator: %s", u.Operator)
+	}
+}
+
+// Conditional evaluates Then when Condition is truthy and Else otherwise,
+// the branch not taken is never evaluated
+type Conditional struct {
+	Condition Expr
+	Then      Expr
+	Else      Expr
+}
+
+func (c *Conditional) Node() Expr {
+	return c
+}
+
+func (c *Conditional) Eval(ctx *EvalContext) (interface{}, error) {
+	condition, err := c.Condition.Eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if toBoolean(condition) {
+		return c.Then.Eval(ctx)
+	}
+
+	return c.Else.Eval(ctx)
 }
 
 type FuncCall struct {
@@ -156,12 +381,21 @@ func (f *FuncCall) Node() Expr {
 
 func (f *FuncCall) Eval(ctx *EvalContext) (interface{}, error) {
 	if function, exists := ctx.FuncMap[f.Name]; exists {
-		return function(ctx, f.Args)
+		result, err := function(ctx, f.Args)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := ctx.checkResult(result); err != nil {
+			return nil, err
+		}
+
+		return result, nil
 	}
 	return nil, fmt.Errorf("undefined function: %s", f.Name)
 }
 
-type Literal[T string | *big.Float] struct {
+type Literal[T string | *big.Float | int64 | bool | time.Duration] struct {
 	Value T
 }
 
@@ -172,3 +406,141 @@ func (l *Literal[T]) Node() Expr {
 func (l *Literal[T]) Eval(ctx *EvalContext) (interface{}, error) {
 	return l.Value, nil
 }
+
+type NullLiteral struct{}
+
+func (n *NullLiteral) Node() Expr {
+	return n
+}
+
+func (n *NullLiteral) Eval(ctx *EvalContext) (interface{}, error) {
+	return nil, nil
+}
+
+// ArrayLiteral constructs a new array, e.g. [ $.a, $.b ]
+type ArrayLiteral struct {
+	Elements []Expr
+}
+
+func (a *ArrayLiteral) Node() Expr {
+	return a
+}
+
+func (a *ArrayLiteral) Eval(ctx *EvalContext) (interface{}, error) {
+	values := make([]any, 0, len(a.Elements))
+
+	for _, element := range a.Elements {
+		value, err := element.Eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		values = append(values, value)
+	}
+
+	return values, nil
+}
+
+// ObjectLiteral constructs a new object, e.g. { "title": $.books[0].name },
+// values are evaluated in source order and a repeated key takes the last
+// value. Like any object the result has no key order, it is encoded with
+// sorted keys.
+type ObjectLiteral struct {
+	Keys   []string
+	Values []Expr
+}
+
+func (o *ObjectLiteral) Node() Expr {
+	return o
+}
+
+func (o *ObjectLiteral) Eval(ctx *EvalContext) (interface{}, error) {
+	object := make(map[string]any, len(o.Keys))
+
+	for i, key := range o.Keys {
+		value, err := o.Values[i].Eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		// missing values are left out of the object
+		if value == Undefined {
+			continue
+		}
+
+		object[key] = value
+	}
+
+	return object, nil
+}
+
+// Lambda names the item a higher-order function binds, e.g. o => o.total
+// the parameter stays visible to nested functions where @ is rebound
+type Lambda struct {
+	Param string
+	Body  Expr
+}
+
+func (l *Lambda) Node() Expr {
+	return l
+}
+
+func (l *Lambda) Eval(ctx *EvalContext) (interface{}, error) {
+	return nil, fmt.Errorf("lambda %s => ... can only be used as a function argument", l.Param)
+}
+
+// rewrite visits every node bottom up and replaces it with the result of fn
+func rewrite(expr Expr, fn func(Expr) (Expr, error)) (Expr, error) {
+	var err error
+
+	rewriteAll := func(exprs []Expr) error {
+		for i, e := range exprs {
+			if exprs[i], err = rewrite(e, fn); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	switch e := expr.(type) {
+	case *BinOp:
+		if e.Left, err = rewrite(e.Left, fn); err != nil {
+			return nil, err
+		}
+		if e.Right, err = rewrite(e.Right, fn); err != nil {
+			return nil, err
+		}
+	case *Conditional:
+		if e.Condition, err = rewrite(e.Condition, fn); err != nil {
+			return nil, err
+		}
+		if e.Then, err = rewrite(e.Then, fn); err != nil {
+			return nil, err
+		}
+		if e.Else, err = rewrite(e.Else, fn); err != nil {
+			return nil, err
+		}
+	case *UnaryOp:
+		if e.Operand, err = rewrite(e.Operand, fn); err != nil {
+			return nil, err
+		}
+	case *Lambda:
+		if e.Body, err = rewrite(e.Body, fn); err != nil {
+			return nil, err
+		}
+	case *FuncCall:
+		if err := rewriteAll(e.Args); err != nil {
+			return nil, err
+		}
+	case *ArrayLiteral:
+		if err := rewriteAll(e.Elements); err != nil {
+			return nil, err
+		}
+	case *ObjectLiteral:
+		if err := rewriteAll(e.Values); err != nil {
+			return nil, err
+		}
+	}
+
+	return fn(expr)
+}
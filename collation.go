@@ -0,0 +1,54 @@
+package yap
+
+import (
+	"strings"
+	"sync"
+
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+// Collation compares strings with the rules of a locale, e.g. in German
+// "ä" sorts between "a" and "b" rather than after "z". The collation
+// tables are compiled into golang.org/x/text, nothing is loaded at runtime.
+// A nil *Collation compares strings by their bytes.
+type Collation struct {
+	// a collate.Collator reuses internal buffers, so it is not safe for
+	// concurrent use, each comparison takes one from the pool
+	collators sync.Pool
+}
+
+// NewCollation creates a collation for a locale, options such as
+// collate.IgnoreCase or collate.IgnoreDiacritics loosen which strings
+// compare as equal
+func NewCollation(tag language.Tag, opts ...collate.Option) *Collation {
+	c := &Collation{}
+	c.collators.New = func() any {
+		return collate.New(tag, opts...)
+	}
+	return c
+}
+
+// WithCollation makes ==, !=, ordering comparisons, sorting and the
+// functions comparing values use the collation for strings, e.g.
+// WithCollation(language.German, collate.IgnoreCase). The default
+// compares strings by their bytes.
+func WithCollation(tag language.Tag, opts ...collate.Option) EvalOption {
+	collation := NewCollation(tag, opts...)
+
+	return func(ctx *EvalContext) {
+		ctx.Collation = collation
+	}
+}
+
+// compare orders two strings, returning -1, 0 or 1
+func (c *Collation) compare(a, b string) int {
+	if c == nil {
+		return strings.Compare(a, b)
+	}
+
+	collator := c.collators.Get().(*collate.Collator)
+	defer c.collators.Put(collator)
+
+	return collator.CompareString(a, b)
+}
@@ -0,0 +1,73 @@
+package yap
+
+import (
+	"sync"
+	"testing"
+
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+func TestCollation(t *testing.T) {
+	data := `{"names": ["Zoë", "Äpfel", "apple", "Bär", "zebra"], "city": "Köln"}`
+
+	// without a collation strings compare by their bytes
+	runEvaluateTests(t, data, []evaluateTest{
+		{`sort($.names)`, `["Bär","Zoë","apple","zebra","Äpfel"]`},
+		{`"Äpfel" < "Bär"`, `false`},
+		{`$.city == "KÖLN"`, `false`},
+	})
+
+	runEvaluateTests(t, data, []evaluateTest{
+		{`sort($.names)`, `["Äpfel","apple","Bär","zebra","Zoë"]`},
+		{`map(sortBy(map($.names, { "n": @ }), @.n), @.n)`, `["Äpfel","apple","Bär","zebra","Zoë"]`},
+		{`"Äpfel" < "Bär"`, `true`},
+		{`min($.names)`, `"Äpfel"`},
+		{`$.city == "Köln"`, `true`},
+		{`$.city == "KÖLN"`, `false`},
+	}, WithCollation(language.German))
+
+	runEvaluateTests(t, data, []evaluateTest{
+		{`$.city == "KÖLN"`, `true`},
+		{`$.city != "koln"`, `true`},
+		{`["KÖLN"] == [$.city]`, `true`},
+		{`contains($.names, "BÄR")`, `true`},
+		{`unique(["a", "A", "b"])`, `["a","b"]`},
+		{`intersect(["a", "B"], ["b"])`, `["B"]`},
+		{`difference(["a", "B"], ["A"])`, `["B"]`},
+	}, WithCollation(language.German, collate.IgnoreCase))
+
+	runEvaluateTests(t, data, []evaluateTest{
+		{`$.city == "koln"`, `true`},
+		{`indexOf($.names, "zoe")`, `0`},
+	}, WithCollation(language.German, collate.IgnoreCase, collate.IgnoreDiacritics))
+
+	// Swedish sorts ä after z
+	runEvaluateTests(t, data, []evaluateTest{
+		{`sort(["äpple", "zon", "apa"])`, `["apa","zon","äpple"]`},
+	}, WithCollation(language.Swedish))
+}
+
+func TestCollationConcurrent(t *testing.T) {
+	evaluator, err := NewEvaluator(`sort($.names) == ["Äpfel", "apple", "Bär", "zebra", "Zoë"] && $.city == "KÖLN"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a collation shared by concurrent evaluations
+	collation := WithCollation(language.German, collate.IgnoreCase)
+	data := `{"names": ["Zoë", "Äpfel", "apple", "Bär", "zebra"], "city": "Köln"}`
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Go(func() {
+			for range 50 {
+				if result, err := evaluator.Eval(data, collation); err != nil || result != true {
+					t.Errorf("expected true, got %v %v", result, err)
+					return
+				}
+			}
+		})
+	}
+	wg.Wait()
+}
@@ -0,0 +1,123 @@
+package yap
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// ComparisonMode decides how <, >, <= and >= treat operands of different
+// types, e.g. a string compared with a number
+type ComparisonMode int
+
+const (
+	// StrictComparison fails the evaluation with a type mismatch error
+	StrictComparison ComparisonMode = iota
+	// LenientComparison makes the comparison false
+	LenientComparison
+)
+
+// WithComparison sets the comparison mode, the default is StrictComparison
+func WithComparison(mode ComparisonMode) EvalOption {
+	return func(ctx *EvalContext) {
+		ctx.Comparison = mode
+	}
+}
+
+// compareOrdered orders two values of the same type, returning -1, 0 or 1.
+// Numbers compare by value, strings with coll, false < true, null is
+// equal to null and arrays compare element by element. Objects have no
+// order and values of different types fail with a type mismatch error.
+func compareOrdered(coll *Collation, left, right any) (int, error) {
+	lRank, rRank := typeRank(left), typeRank(right)
+
+	if lRank != rRank {
+		return 0, fmt.Errorf("cannot compare %s with %s", typeName(left), typeName(right))
+	}
+
+	if _, ok := left.(map[string]any); ok {
+		return 0, fmt.Errorf("cannot compare object with object")
+	}
+
+	return compareTotal(coll, left, right), nil
+}
+
+// typeRank orders values of different types in compareTotal
+func typeRank(v any) int {
+	switch v.(type) {
+	case undefined:
+		return -1
+	case nil:
+		return 0
+	case bool:
+		return 1
+	case string:
+		return 3
+	case time.Time:
+		return 4
+	case time.Duration:
+		return 5
+	case []any:
+		return 6
+	case map[string]any:
+		return 7
+	}
+
+	if isNumber(v) {
+		return 2
+	}
+
+	return 8
+}
+
+// compareTotal is a total order over all values, used for sorting. Values
+// of the same type order as in compareOrdered, values of different types
+// order by type: undefined < null < booleans < numbers
+// < strings < times < durations < arrays < objects. Arrays compare element
+// by element, objects by their sorted keys and then their values.
+func compareTotal(coll *Collation, left, right any) int {
+	lRank, rRank := typeRank(left), typeRank(right)
+
+	if lRank != rRank {
+		return cmpInt(int64(lRank), int64(rRank))
+	}
+
+	switch l := left.(type) {
+	case bool:
+		r := right.(bool)
+		switch {
+		case l == r:
+			return 0
+		case r:
+			return -1
+		}
+		return 1
+	case string:
+		return coll.compare(l, right.(string))
+	case time.Time:
+		return l.Compare(right.(time.Time))
+	case time.Duration:
+		return cmpInt(int64(l), int64(right.(time.Duration)))
+	case []any:
+		return slices.CompareFunc(l, right.([]any), func(a, b any) int {
+			return compareTotal(coll, a, b)
+		})
+	case map[string]any:
+		r := right.(map[string]any)
+		lKeys, rKeys := sortedKeys(l), sortedKeys(r)
+
+		if cmp := slices.Compare(lKeys, rKeys); cmp != 0 {
+			return cmp
+		}
+
+		for _, key := range lKeys {
+			if cmp := compareTotal(coll, l[key], r[key]); cmp != 0 {
+				return cmp
+			}
+		}
+		return 0
+	}
+
+	c, _ := compareNumbers(left, right)
+	return c
+}
@@ -0,0 +1,302 @@
+package yap
+
+import (
+	"math/big"
+	"time"
+)
+
+// The compiler translates an expression tree into a program for the stack
+// machine in vm.go. Operators keep the semantics of the tree walker by
+// sharing BinOp.apply and UnaryOp.apply, function calls receive their
+// arguments compiled into programs of their own, so functions still
+// decide which arguments to evaluate and in which scope.
+
+// opcode is the operation of an instruction
+type opcode uint8
+
+const (
+	// opConst pushes consts[arg]
+	opConst opcode = iota
+	// opPath pushes the value of paths[arg]
+	opPath
+	// opBinary pops two operands and pushes binOps[arg] applied to them
+	opBinary
+	// opUnary replaces the top of the stack with unaryOps[arg] applied to it
+	opUnary
+	// opJump continues at arg
+	opJump
+	// opJumpIfFalse pops the top of the stack and continues at arg when
+	// it is falsy
+	opJumpIfFalse
+	// opAnd replaces a falsy top of the stack with false and continues at
+	// arg, a truthy top is popped
+	opAnd
+	// opOr replaces a truthy top of the stack with true and continues at
+	// arg, a falsy top is popped
+	opOr
+	// opBool replaces the top of the stack with its truthiness
+	opBool
+	// opCoalesce continues at arg when the top of the stack is present,
+	// a null or missing top is popped
+	opCoalesce
+	// opLenient evaluates missing paths as Undefined until opRestore
+	opLenient
+	// opRestore restores the missing key behaviour before opLenient
+	opRestore
+	// opArray pops arg values and pushes them as an array
+	opArray
+	// opObject pops the values of the keys in objects[arg] and pushes the
+	// object
+	opObject
+	// opCall pushes the result of calls[arg]
+	opCall
+	// opEval pushes the result of evaluating nodes[arg] by walking the tree
+	opEval
+)
+
+// instruction is an opcode with its operand, an index into one of the
+// program tables or a jump target
+type instruction struct {
+	op  opcode
+	arg int32
+}
+
+// program is a compiled expression, it is an Expr itself so compiled
+// function arguments can be passed to functions unchanged
+type program struct {
+	code      []instruction
+	consts    []any
+	paths     []*pathExpr
+	binOps    []*BinOp
+	unaryOps  []*UnaryOp
+	objects   [][]string
+	calls     []*FuncCall
+	nodes     []Expr
+	stackSize int
+}
+
+func (p *program) Node() Expr {
+	return p
+}
+
+// pathExpr is an identifier whose path is parsed once at compile time
+type pathExpr struct {
+	key  string
+	path *Path
+}
+
+func newPathExpr(ident *Ident) (*pathExpr, error) {
+	path, err := ParsePath(ident.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pathExpr{key: identKey(path), path: path}, nil
+}
+
+func (p *pathExpr) Node() Expr {
+	return p
+}
+
+func (p *pathExpr) Eval(ctx *EvalContext) (interface{}, error) {
+	return resolveIdent(ctx, p.key, p.path)
+}
+
+type compiler struct {
+	program *program
+	// depth is the stack depth after the instructions emitted so far
+	depth int
+}
+
+// compile translates expr into a program
+func compile(expr Expr) (*program, error) {
+	c := &compiler{program: &program{}}
+
+	if err := c.compile(expr); err != nil {
+		return nil, err
+	}
+
+	return c.program, nil
+}
+
+// emit appends an instruction which changes the stack depth by effect and
+// returns its position
+func (c *compiler) emit(op opcode, arg int, effect int) int {
+	c.program.code = append(c.program.code, instruction{op: op, arg: int32(arg)})
+
+	c.depth += effect
+	c.program.stackSize = max(c.program.stackSize, c.depth)
+
+	return len(c.program.code) - 1
+}
+
+// patch points the jump at position at to the next instruction
+func (c *compiler) patch(at int) {
+	c.program.code[at].arg = int32(len(c.program.code))
+}
+
+func (c *compiler) constant(value any) {
+	c.program.consts = append(c.program.consts, value)
+	c.emit(opConst, len(c.program.consts)-1, 1)
+}
+
+func (c *compiler) compile(expr Expr) error {
+	p := c.program
+
+	switch e := expr.(type) {
+	case *Literal[string]:
+		c.constant(e.Value)
+	case *Literal[*big.Float]:
+		c.constant(e.Value)
+	case *Literal[int64]:
+		c.constant(e.Value)
+	case *Literal[bool]:
+		c.constant(e.Value)
+	case *Literal[time.Duration]:
+		c.constant(e.Value)
+	case *RegexLiteral:
+		c.constant(e.Pattern)
+	case *NullLiteral:
+		c.constant(nil)
+	case *constExpr:
+		c.constant(e.Value)
+	case *Ident:
+		path, err := newPathExpr(e)
+		if err != nil {
+			return err
+		}
+		p.paths = append(p.paths, path)
+		c.emit(opPath, len(p.paths)-1, 1)
+	case *pathExpr:
+		p.paths = append(p.paths, e)
+		c.emit(opPath, len(p.paths)-1, 1)
+	case *BinOp:
+		return c.compileBinOp(e)
+	case *UnaryOp:
+		if err := c.compile(e.Operand); err != nil {
+			return err
+		}
+		p.unaryOps = append(p.unaryOps, e)
+		c.emit(opUnary, len(p.unaryOps)-1, 0)
+	case *Conditional:
+		if err := c.compile(e.Condition); err != nil {
+			return err
+		}
+		toElse := c.emit(opJumpIfFalse, 0, -1)
+
+		if err := c.compile(e.Then); err != nil {
+			return err
+		}
+		toEnd := c.emit(opJump, 0, -1)
+
+		c.patch(toElse)
+		if err := c.compile(e.Else); err != nil {
+			return err
+		}
+		c.patch(toEnd)
+	case *ArrayLiteral:
+		for _, element := range e.Elements {
+			if err := c.compile(element); err != nil {
+				return err
+			}
+		}
+		c.emit(opArray, len(e.Elements), 1-len(e.Elements))
+	case *ObjectLiteral:
+		for _, value := range e.Values {
+			if err := c.compile(value); err != nil {
+				return err
+			}
+		}
+		p.objects = append(p.objects, e.Keys)
+		c.emit(opObject, len(p.objects)-1, 1-len(e.Values))
+	case *FuncCall:
+		args := make([]Expr, len(e.Args))
+		for i, arg := range e.Args {
+			compiled, err := compileArg(arg)
+			if err != nil {
+				return err
+			}
+			args[i] = compiled
+		}
+		p.calls = append(p.calls, &FuncCall{Name: e.Name, Args: args})
+		c.emit(opCall, len(p.calls)-1, 1)
+	default:
+		p.nodes = append(p.nodes, expr)
+		c.emit(opEval, len(p.nodes)-1, 1)
+	}
+
+	return nil
+}
+
+func (c *compiler) compileBinOp(b *BinOp) error {
+	switch b.Operator {
+	case "??":
+		c.emit(opLenient, 0, 0)
+		if err := c.compile(b.Left); err != nil {
+			return err
+		}
+		c.emit(opRestore, 0, 0)
+
+		toEnd := c.emit(opCoalesce, 0, -1)
+		if err := c.compile(b.Right); err != nil {
+			return err
+		}
+		c.patch(toEnd)
+		return nil
+	case "&&", "||":
+		if err := c.compile(b.Left); err != nil {
+			return err
+		}
+
+		op := opAnd
+		if b.Operator == "||" {
+			op = opOr
+		}
+		toEnd := c.emit(op, 0, -1)
+
+		if err := c.compile(b.Right); err != nil {
+			return err
+		}
+		c.emit(opBool, 0, 0)
+		c.patch(toEnd)
+		return nil
+	}
+
+	if err := c.compile(b.Left); err != nil {
+		return err
+	}
+	if err := c.compile(b.Right); err != nil {
+		return err
+	}
+
+	c.program.binOps = append(c.program.binOps, b)
+	c.emit(opBinary, len(c.program.binOps)-1, -1)
+	return nil
+}
+
+// compileArg compiles a function argument. Constants and paths are passed
+// as they are, a lambda keeps its parameter with the body compiled.
+func compileArg(arg Expr) (Expr, error) {
+	if _, ok := constantValue(arg); ok {
+		return arg, nil
+	}
+
+	switch a := arg.(type) {
+	case *pathExpr:
+		return a, nil
+	case *Ident:
+		return newPathExpr(a)
+	case *Lambda:
+		body, err := compileArg(a.Body)
+		if err != nil {
+			return nil, err
+		}
+		return &Lambda{Param: a.Param, Body: body}, nil
+	}
+
+	compiled, err := compile(arg)
+	if err != nil {
+		return nil, err
+	}
+	return compiled, nil
+}
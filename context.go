@@ -0,0 +1,145 @@
+package yap
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync/atomic"
+)
+
+// EvalContext is a lexical scope, Json is always the document root ($)
+// while Locals holds the bindings introduced by higher-order functions,
+// e.g. @ for the current item or a lambda parameter. Lookups that miss
+// continue in the Parent scope.
+type EvalContext struct {
+	Json    any
+	FuncMap map[string]Function
+	Parent  *EvalContext
+	Locals  map[string]any
+	// MissingKeys decides what a path with a missing key or index yields
+	MissingKeys MissingKeyMode
+	// Precision is the mantissa precision in bits of computed numbers, 0
+	// uses the largest precision of the operands
+	Precision uint
+	// Rounding is the rounding mode of computed numbers and round()
+	Rounding big.RoundingMode
+	// Clock provides the time returned by now(), nil uses time.Now
+	Clock Clock
+	// Comparison decides how ordering comparisons treat mismatched types
+	Comparison ComparisonMode
+	// Collation compares strings, nil compares them by their bytes
+	Collation *Collation
+	// Parallelism is the number of goroutines evaluating the items of large
+	// arrays in where, map and similar functions, 0 or 1 evaluates them on
+	// the calling goroutine
+	Parallelism int
+	// Context stops the evaluation once it is done, nil never stops it
+	Context context.Context
+	// MaxSteps, MaxResultSize and MaxDepth limit the evaluation, see Limit
+	MaxSteps      int
+	MaxResultSize int
+	MaxDepth      int
+	// steps counts the steps of the evaluation when it is limited or
+	// cancellable, it is shared by all scopes
+	steps *atomic.Int64
+	// depth is the number of scopes enclosing this one
+	depth int
+	// shared holds the subexpressions of a RuleSet evaluated for the document
+	shared []sharedValue
+}
+
+// Lookup finds a binding in this scope or any enclosing scope
+func (ctx *EvalContext) Lookup(name string) (any, bool) {
+	for scope := ctx; scope != nil; scope = scope.Parent {
+		if value, exists := scope.Locals[name]; exists {
+			return value, true
+		}
+	}
+
+	return nil, false
+}
+
+// NewScope creates a child scope sharing the document root
+func (ctx *EvalContext) NewScope(locals map[string]any) *EvalContext {
+	scope := *ctx
+	scope.Parent = ctx
+	scope.Locals = locals
+	scope.depth = ctx.depth + 1
+
+	return &scope
+}
+
+// resolve applies the missing key behaviour to the result of resolving a path
+func (ctx *EvalContext) resolve(value any, err error) (any, error) {
+	if err == nil {
+		return value, nil
+	}
+
+	var missing *MissingError
+	if !errors.As(err, &missing) {
+		return nil, err
+	}
+
+	switch ctx.MissingKeys {
+	case MissingAsNull:
+		return nil, nil
+	case MissingAsUndefined:
+		return Undefined, nil
+	default:
+		return nil, err
+	}
+}
+
+// newFloat allocates a number using the precision and rounding settings
+func (ctx *EvalContext) newFloat() *big.Float {
+	return new(big.Float).SetPrec(ctx.Precision).SetMode(ctx.Rounding)
+}
+
+// MissingKeyMode is the behaviour of a path that cannot be resolved
+type MissingKeyMode int
+
+const (
+	// MissingAsError aborts the evaluation with the resolver error
+	MissingAsError MissingKeyMode = iota
+	// MissingAsNull resolves the path to null
+	MissingAsNull
+	// MissingAsUndefined resolves the path to Undefined, which makes
+	// any comparison involving it false
+	MissingAsUndefined
+)
+
+type undefined struct{}
+
+func (u undefined) String() string {
+	return "undefined"
+}
+
+// Undefined is the value of a missing path under MissingAsUndefined, like
+// SQL's NULL it is not equal, less or greater than anything, itself included
+var Undefined any = undefined{}
+
+// EvalOption configures a single evaluation
+type EvalOption func(ctx *EvalContext)
+
+// WithMissingKeys sets the missing key behaviour, the default is MissingAsError
+func WithMissingKeys(mode MissingKeyMode) EvalOption {
+	return func(ctx *EvalContext) {
+		ctx.MissingKeys = mode
+	}
+}
+
+// WithPrecision sets the precision in bits used for arithmetic and math
+// functions, by default the largest precision of the operands is kept
+func WithPrecision(prec uint) EvalOption {
+	return func(ctx *EvalContext) {
+		ctx.Precision = prec
+	}
+}
+
+// WithRounding sets the rounding mode used for arithmetic and round(), the
+// default is big.ToNearestEven
+func WithRounding(mode big.RoundingMode) EvalOption {
+	return func(ctx *EvalContext) {
+		ctx.Rounding = mode
+	}
+}
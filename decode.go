@@ -0,0 +1,462 @@
+package yap
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// An expression only ever reads the document through its paths, so only
+// the subtrees those paths lead to are decoded. The raw document is
+// scanned without decoding anything else, a megabyte payload of which a
+// rule reads $.type costs a scan instead of building every map and slice.
+
+// pathTree is the set of document paths an expression refers to, as a
+// tree of the keys and indices followed from the root
+type pathTree struct {
+	// whole marks a value that is used as a whole and decoded completely
+	whole   bool
+	keys    map[string]*pathTree
+	indices map[int]*pathTree
+}
+
+func (t *pathTree) key(key string) *pathTree {
+	if t.keys == nil {
+		t.keys = map[string]*pathTree{}
+	}
+	if _, exists := t.keys[key]; !exists {
+		t.keys[key] = &pathTree{}
+	}
+	return t.keys[key]
+}
+
+func (t *pathTree) index(index int) *pathTree {
+	if t.indices == nil {
+		t.indices = map[int]*pathTree{}
+	}
+	if _, exists := t.indices[index]; !exists {
+		t.indices[index] = &pathTree{}
+	}
+	return t.indices[index]
+}
+
+// add adds the path of an identifier resolved against the root
+func (t *pathTree) add(name string) {
+	node := t
+
+	for i, segment := range strings.Split(name, ".") {
+		segment = strings.TrimSpace(segment)
+
+		if key := IndexedPattern.ReplaceAllString(segment, ""); i > 0 || key != "$" {
+			node = node.key(key)
+		}
+
+		for _, match := range IndexedPattern.FindAllStringSubmatch(segment, -1) {
+			index, _ := strconv.Atoi(match[1])
+			node = node.index(index)
+		}
+	}
+
+	node.whole = true
+}
+
+// collectPaths lists the document paths expr refers to. Identifiers bound
+// by higher-order functions, @ and lambda parameters, refer to items of
+// values reached through other paths and are left out.
+func collectPaths(expr Expr) *pathTree {
+	paths := &pathTree{}
+	collect(expr, paths, map[string]bool{})
+	return paths
+}
+
+func collect(expr Expr, paths *pathTree, bound map[string]bool) {
+	collectAll := func(exprs []Expr) {
+		for _, e := range exprs {
+			collect(e, paths, bound)
+		}
+	}
+
+	switch e := expr.(type) {
+	case *Ident:
+		path, err := ParsePath(e.Name)
+		if err != nil {
+			return
+		}
+
+		if key := identKey(path); !strings.HasPrefix(key, "@") && !bound[key] {
+			paths.add(e.Name)
+		}
+	case *BinOp:
+		collectAll([]Expr{e.Left, e.Right})
+	case *UnaryOp:
+		collect(e.Operand, paths, bound)
+	case *Conditional:
+		collectAll([]Expr{e.Condition, e.Then, e.Else})
+	case *FuncCall:
+		collectAll(e.Args)
+	case *ArrayLiteral:
+		collectAll(e.Elements)
+	case *ObjectLiteral:
+		collectAll(e.Values)
+	case *Lambda:
+		scope := map[string]bool{e.Param: true}
+		for name := range bound {
+			scope[name] = true
+		}
+		collect(e.Body, paths, scope)
+	}
+}
+
+// decodeDocument unmarshals the parts of a JSON object that paths refer to,
+// the values skipped are validated in the same scan, numbers including
+// their range. A document which is not a valid object is unmarshaled
+// completely so it fails exactly as json.Unmarshal does.
+func decodeDocument(data []byte, paths *pathTree) (map[string]any, error) {
+	start := skipSpace(data, 0)
+
+	if !paths.whole && start < len(data) && data[start] == '{' {
+		js, end, err := decodeSelected(data, start, paths, 0)
+		if err == nil && skipSpace(data, end) == len(data) {
+			return js.(map[string]any), nil
+		}
+	}
+
+	var js map[string]any
+	err := json.Unmarshal(data, &js)
+	return js, err
+}
+
+// errInvalid is returned by the selective scan for a document that is not
+// valid JSON, the error of json.Unmarshal is reported instead
+var errInvalid = errors.New("invalid JSON")
+
+// maxScanDepth is the nesting json.Unmarshal accepts
+const maxScanDepth = 10000
+
+// decodeSelected decodes the JSON value at data[i:], descending only into
+// the keys and indices of paths, it returns the value and the position
+// after it
+func decodeSelected(data []byte, i int, paths *pathTree, depth int) (any, int, error) {
+	if depth >= maxScanDepth || i >= len(data) {
+		return nil, 0, errInvalid
+	}
+
+	switch {
+	case data[i] == '{' && paths.keys != nil && !paths.whole:
+		return decodeSelectedObject(data, i, paths, depth+1)
+	case data[i] == '[' && paths.indices != nil && !paths.whole:
+		return decodeSelectedArray(data, i, paths, depth+1)
+	}
+
+	// a value used whole, or not of the type the path continues with,
+	// which fails when resolved
+	end := scanValue(data, i, depth)
+	if end < 0 {
+		return nil, 0, errInvalid
+	}
+
+	var value any
+	if err := json.Unmarshal(data[i:end], &value); err != nil {
+		return nil, 0, err
+	}
+	return value, end, nil
+}
+
+func decodeSelectedObject(data []byte, i int, paths *pathTree, depth int) (any, int, error) {
+	object := map[string]any{}
+
+	i = skipSpace(data, i+1)
+	if i < len(data) && data[i] == '}' {
+		return object, i + 1, nil
+	}
+
+	for {
+		if i >= len(data) || data[i] != '"' {
+			return nil, 0, errInvalid
+		}
+
+		keyEnd := scanString(data, i)
+		if keyEnd < 0 {
+			return nil, 0, errInvalid
+		}
+		raw := data[i+1 : keyEnd-1]
+
+		// keys are only copied when a path refers to them
+		var key string
+		var next *pathTree
+
+		escaped := bytes.IndexByte(raw, '\\') >= 0
+		if escaped {
+			if err := json.Unmarshal(data[i:keyEnd], &key); err != nil {
+				return nil, 0, err
+			}
+			next = paths.keys[key]
+		} else {
+			next = paths.keys[string(raw)]
+		}
+
+		// the value starts after the colon
+		i = skipSpace(data, keyEnd)
+		if i >= len(data) || data[i] != ':' {
+			return nil, 0, errInvalid
+		}
+		i = skipSpace(data, i+1)
+
+		if next != nil {
+			value, end, err := decodeSelected(data, i, next, depth)
+			if err != nil {
+				return nil, 0, err
+			}
+
+			if !escaped {
+				key = string(raw)
+			}
+			object[key] = value
+			i = end
+		} else if i = scanValue(data, i, depth); i < 0 {
+			return nil, 0, errInvalid
+		}
+
+		i = skipSpace(data, i)
+		if i >= len(data) {
+			return nil, 0, errInvalid
+		}
+
+		switch data[i] {
+		case '}':
+			return object, i + 1, nil
+		case ',':
+			i = skipSpace(data, i+1)
+		default:
+			return nil, 0, errInvalid
+		}
+	}
+}
+
+// decodeSelectedArray keeps the length of the array, items no path refers
+// to are null
+func decodeSelectedArray(data []byte, i int, paths *pathTree, depth int) (any, int, error) {
+	array := []any{}
+
+	i = skipSpace(data, i+1)
+	if i < len(data) && data[i] == ']' {
+		return array, i + 1, nil
+	}
+
+	for {
+		if next := paths.indices[len(array)]; next != nil {
+			value, end, err := decodeSelected(data, i, next, depth)
+			if err != nil {
+				return nil, 0, err
+			}
+
+			array = append(array, value)
+			i = end
+		} else if i = scanValue(data, i, depth); i < 0 {
+			return nil, 0, errInvalid
+		} else {
+			array = append(array, nil)
+		}
+
+		i = skipSpace(data, i)
+		if i >= len(data) {
+			return nil, 0, errInvalid
+		}
+
+		switch data[i] {
+		case ']':
+			return array, i + 1, nil
+		case ',':
+			i = skipSpace(data, i+1)
+		default:
+			return nil, 0, errInvalid
+		}
+	}
+}
+
+// skipSpace returns the position of the first non-whitespace byte from i
+func skipSpace(data []byte, i int) int {
+	for i < len(data) {
+		switch data[i] {
+		case ' ', '\t', '\n', '\r':
+			i++
+		default:
+			return i
+		}
+	}
+	return i
+}
+
+// scanString returns the position after the string starting at i, or -1
+// when it is not a valid JSON string
+func scanString(data []byte, i int) int {
+	for i++; i < len(data); i++ {
+		switch c := data[i]; {
+		case c == '"':
+			return i + 1
+		case c < 0x20:
+			return -1
+		case c == '\\':
+			if i++; i >= len(data) {
+				return -1
+			}
+
+			switch data[i] {
+			case '"', '\\', '/', 'b', 'f', 'n', 'r', 't':
+			case 'u':
+				if i+4 >= len(data) {
+					return -1
+				}
+				for _, h := range data[i+1 : i+5] {
+					if !isHexDigit(h) {
+						return -1
+					}
+				}
+				i += 4
+			default:
+				return -1
+			}
+		}
+	}
+	return -1
+}
+
+// scanValue returns the position after the JSON value starting at i, or
+// -1 when it is not valid
+func scanValue(data []byte, i int, depth int) int {
+	if depth >= maxScanDepth || i >= len(data) {
+		return -1
+	}
+
+	switch data[i] {
+	case '"':
+		return scanString(data, i)
+	case '{', '[':
+		return scanContainer(data, i, depth+1)
+	case 't':
+		return scanLiteral(data, i, "true")
+	case 'f':
+		return scanLiteral(data, i, "false")
+	case 'n':
+		return scanLiteral(data, i, "null")
+	}
+
+	return scanNumber(data, i)
+}
+
+// scanContainer returns the position after the object or array starting
+// at i, or -1 when it is not valid
+func scanContainer(data []byte, i int, depth int) int {
+	closing := byte(']')
+	if data[i] == '{' {
+		closing = '}'
+	}
+
+	i = skipSpace(data, i+1)
+	if i < len(data) && data[i] == closing {
+		return i + 1
+	}
+
+	for {
+		if closing == '}' {
+			if i >= len(data) || data[i] != '"' {
+				return -1
+			}
+			if i = scanString(data, i); i < 0 {
+				return -1
+			}
+			if i = skipSpace(data, i); i >= len(data) || data[i] != ':' {
+				return -1
+			}
+			i = skipSpace(data, i+1)
+		}
+
+		if i = scanValue(data, i, depth); i < 0 {
+			return -1
+		}
+
+		if i = skipSpace(data, i); i >= len(data) {
+			return -1
+		}
+
+		switch data[i] {
+		case closing:
+			return i + 1
+		case ',':
+			i = skipSpace(data, i+1)
+		default:
+			return -1
+		}
+	}
+}
+
+// scanLiteral returns the position after true, false or null at i, or -1
+func scanLiteral(data []byte, i int, literal string) int {
+	if !bytes.HasPrefix(data[i:], []byte(literal)) {
+		return -1
+	}
+	return i + len(literal)
+}
+
+// scanNumber returns the position after the number starting at i, or -1
+// when it is not a valid JSON number or out of the range of a float64, as
+// json.Unmarshal decodes numbers
+func scanNumber(data []byte, i int) int {
+	start := i
+	exponent := false
+
+	digits := func(i int) int {
+		start := i
+		for i < len(data) && data[i] >= '0' && data[i] <= '9' {
+			i++
+		}
+		if i == start {
+			return -1
+		}
+		return i
+	}
+
+	if data[i] == '-' {
+		i++
+	}
+
+	// no leading zeros
+	if i < len(data) && data[i] == '0' {
+		i++
+	} else if i = digits(i); i < 0 {
+		return -1
+	}
+
+	if i < len(data) && data[i] == '.' {
+		if i = digits(i + 1); i < 0 {
+			return -1
+		}
+	}
+
+	if i < len(data) && (data[i] == 'e' || data[i] == 'E') {
+		exponent = true
+		i++
+		if i < len(data) && (data[i] == '+' || data[i] == '-') {
+			i++
+		}
+		if i = digits(i); i < 0 {
+			return -1
+		}
+	}
+
+	// only a number with an exponent or as many digits as
+	// math.MaxFloat64 can be out of range
+	if exponent || i-start > 308 {
+		if _, err := strconv.ParseFloat(string(data[start:i]), 64); err != nil {
+			return -1
+		}
+	}
+
+	return i
+}
+
+func isHexDigit(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
@@ -0,0 +1,223 @@
+package yap
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const decodeJson = `{
+	"type": "order",
+	"a": {"b": 1, "skip": {"deep": [1, 2, {"x": "y"}]}},
+	"c": [{"d": "zero"}, {"d": "one", "e": true}, "two"],
+	"items": [{"v": 1, "w": 2}, {"v": 3, "w": 2}],
+	"esc\"aped": "quote",
+	"café": "unicode",
+	"dup": 1,
+	"dup": {"x": 2},
+	"str": "a \"string\" with ] and }",
+	"num": 12.5e1,
+	"nothing": null,
+	"empty": {}, "none": []
+}`
+
+func TestCollectPaths(t *testing.T) {
+	paths := collectPaths(parseExpression(t, `$.a.b == 1 && any(filter($.items, x => x.v > @.w), @.v > 0) && $.c[1].d == "one"`))
+
+	expect := &pathTree{keys: map[string]*pathTree{
+		"a":     {keys: map[string]*pathTree{"b": {whole: true}}},
+		"items": {whole: true},
+		"c": {indices: map[int]*pathTree{
+			1: {keys: map[string]*pathTree{"d": {whole: true}}},
+		}},
+	}}
+
+	if !reflect.DeepEqual(paths, expect) {
+		t.Errorf("unexpected paths %s", describePaths(paths))
+	}
+
+	if paths := collectPaths(parseExpression(t, `keys($)`)); !paths.whole {
+		t.Errorf("expected $ to use the whole document")
+	}
+
+	// a lambda parameter is only bound inside the lambda
+	paths = collectPaths(parseExpression(t, `map($.items, x => x.v) == x`))
+	if _, ok := paths.keys["x"]; !ok {
+		t.Errorf("expected x outside the lambda to be a path, got %s", describePaths(paths))
+	}
+}
+
+func parseExpression(t *testing.T, expression string) Expr {
+	t.Helper()
+
+	tokens, err := Tokenize(strings.NewReader(expression))
+	if err != nil {
+		t.Fatalf("%s: %v", expression, err)
+	}
+
+	expr, err := NewParser(tokens).Parse()
+	if err != nil {
+		t.Fatalf("%s: %v", expression, err)
+	}
+
+	return expr
+}
+
+func describePaths(paths *pathTree) string {
+	parts := []string{}
+	if paths.whole {
+		parts = append(parts, "*")
+	}
+	for key, next := range paths.keys {
+		parts = append(parts, fmt.Sprintf("%s:%s", key, describePaths(next)))
+	}
+	for index, next := range paths.indices {
+		parts = append(parts, fmt.Sprintf("[%d]:%s", index, describePaths(next)))
+	}
+	return "{" + strings.Join(parts, " ") + "}"
+}
+
+func TestDecodeDocumentSelectsPaths(t *testing.T) {
+	paths := collectPaths(parseExpression(t, `$.type == "order" && $.a.b > 0 && $.c[1].d != null && $.dup.x == 2`))
+
+	js, err := decodeDocument([]byte(decodeJson), paths)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := map[string]any{
+		"type": "order",
+		"a":    map[string]any{"b": float64(1)},
+		"c":    []any{nil, map[string]any{"d": "one"}, nil},
+		"dup":  map[string]any{"x": float64(2)},
+	}
+
+	if !reflect.DeepEqual(js, expect) {
+		t.Errorf("expected %v, got %v", expect, js)
+	}
+}
+
+func TestSelectiveDecodingMatchesFullDecoding(t *testing.T) {
+	expressions := []string{
+		`$.type`,
+		`$.a.b + $.num`,
+		`$.a.skip.deep[2].x`,
+		`$.c[1].e && $.c[2] == "two"`,
+		`$.c[0].d.missing`,
+		`$.c[5]`,
+		`$.type.length`,
+		`$.c.d`,
+		`$.a[0]`,
+		`$.str`,
+		`$.nothing.x`,
+		`$.empty.x ?? length($.none)`,
+		`$.dup`,
+		`$.dup.x`,
+		`map($.items, x => x.v * @.w)`,
+		`$.missing ?? "default"`,
+		`$`,
+		`keys($)`,
+		`1 + 1`,
+	}
+
+	documents := []string{decodeJson, `[1, 2]`, `null`, `"text"`, `{"a": }`, ``, ` {"type": "spaced"} `, `{"a": {"b": 1}} trailing`,
+		// invalid values that are skipped
+		`{"type": "x", "skip": [1, }`, `{"type": "x", "skip": tru}`, `{"type": "x", "skip": 01}`, `{"type": "x", "skip": {"k" 1}}`,
+		`{"type": "x", "skip": "\q"}`, "{\"type\": \"x\", \"skip\": \"\x01\"}", `{"type": "x", "skip": [`, `{"type": "x", "c": [1 2]}`,
+		// numbers out of the range of a float64 that are skipped
+		`{"a": 1e999, "type": "x"}`, `{"type": "x", "skip": [-1E+400]}`, `{"type": "x", "skip": 1` + strings.Repeat("0", 309) + `}`,
+		`{"type": "x", "small": 1e-999, "long": 1` + strings.Repeat("0", 300) + `}`}
+
+	for _, document := range documents {
+		var full map[string]any
+		fullErr := json.Unmarshal([]byte(document), &full)
+
+		for _, expression := range expressions {
+			evaluator, err := NewEvaluator(expression)
+			if err != nil {
+				t.Fatalf("%s: %v", expression, err)
+			}
+
+			selective := encodeResult(evaluator.Eval(document, WithMissingKeys(MissingAsNull)))
+
+			expect := "error: " + fmt.Sprint(fullErr)
+			if fullErr == nil {
+				expect = encodeResult(evaluator.program.Eval(newEvalContext(full, []EvalOption{WithMissingKeys(MissingAsNull)})))
+			}
+
+			if selective != expect {
+				t.Errorf("%s on %q: expected %s, got %s", expression, document, expect, selective)
+			}
+		}
+	}
+}
+
+func TestScanValueMatchesUnmarshal(t *testing.T) {
+	documents := []string{
+		`{}`, `[]`, `{"a": [1, -2.5e+3, true, false, null, "s\u00e9\n"]}`, `"\ud83c\udf0c"`, `-0`, `0.5E-1`,
+		`{"a" : 1 , "b" : [ ] }`, strings.Repeat("[", 10000) + strings.Repeat("]", 10000),
+		`{`, `{"a"}`, `{"a":}`, `{"a":1,}`, `[1,]`, `[,1]`, `{1: 2}`, `nul`, `truee`, `-`, `1.`, `.5`, `1e`, `+1`, `00`,
+		`"\u12g4"`, `"\x"`, `"unterminated`, "\"tab\tinside\"", `[1 2]`, `{"a":1 "b":2}`,
+		`1e308`, `1e309`, `-1.5e-400`, `[0.1e999]`, strings.Repeat("9", 308), strings.Repeat("9", 309),
+		strings.Repeat("[", 10001) + strings.Repeat("]", 10001),
+	}
+
+	for _, document := range documents {
+		data := []byte(document)
+		end := scanValue(data, skipSpace(data, 0), 0)
+		valid := end >= 0 && skipSpace(data, end) == len(data)
+
+		// json.Valid does not check the range of numbers, unmarshaling does
+		if decodable := json.Unmarshal(data, new(any)) == nil; valid != decodable {
+			t.Errorf("%.40s: expected valid to be %v", document, decodable)
+		}
+	}
+}
+
+// largeDocument is an event of about a megabyte of which rules read a few fields
+func largeDocument() string {
+	items := make([]string, 5000)
+	for i := range items {
+		items[i] = fmt.Sprintf(`{"id": %d, "name": "item %d", "tags": ["a", "b", "c"], "price": %d.99, "meta": {"seen": true, "note": "%s"}}`, i, i, i, strings.Repeat("x", 64))
+	}
+
+	return fmt.Sprintf(`{"type": "order", "items": [%s], "customer": {"id": 7, "tier": "gold"}}`, strings.Join(items, ","))
+}
+
+func BenchmarkDecode(b *testing.B) {
+	data := []byte(largeDocument())
+	paths := collectPaths(parseExpression(&testing.T{}, `$.type == "order" && $.customer.tier == "gold"`))
+
+	b.Run("full", func(b *testing.B) {
+		b.SetBytes(int64(len(data)))
+		b.ReportAllocs()
+		for b.Loop() {
+			var js map[string]any
+			if err := json.Unmarshal(data, &js); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("valid", func(b *testing.B) {
+		b.SetBytes(int64(len(data)))
+		b.ReportAllocs()
+		for b.Loop() {
+			if !json.Valid(data) {
+				b.Fatal("invalid document")
+			}
+		}
+	})
+
+	b.Run("selective", func(b *testing.B) {
+		b.SetBytes(int64(len(data)))
+		b.ReportAllocs()
+		for b.Loop() {
+			if _, err := decodeDocument(data, paths); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,172 @@
+package yap
+
+import (
+	"maps"
+	"math/big"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// valuesEqual compares two values structurally. Numbers are equal by value
+// whatever their representation, e.g. a float64 decoded from JSON and a
+// *big.Float literal, arrays and objects are compared recursively and
+// Undefined is not equal to anything. Strings are equal when coll compares
+// them as equal.
+func valuesEqual(coll *Collation, left, right any) bool {
+	if isNumber(left) {
+		c, ok := compareNumbers(left, right)
+		return ok && c == 0
+	}
+
+	switch l := left.(type) {
+	case nil:
+		return right == nil
+	case string:
+		r, ok := right.(string)
+		return ok && coll.compare(l, r) == 0
+	case bool:
+		r, ok := right.(bool)
+		return ok && l == r
+	case time.Time:
+		r, ok := right.(time.Time)
+		return ok && l.Equal(r)
+	case time.Duration:
+		r, ok := right.(time.Duration)
+		return ok && l == r
+	case []any:
+		r, ok := right.([]any)
+		return ok && slices.EqualFunc(l, r, func(a, b any) bool {
+			return valuesEqual(coll, a, b)
+		})
+	case map[string]any:
+		r, ok := right.(map[string]any)
+		return ok && maps.EqualFunc(l, r, func(a, b any) bool {
+			return valuesEqual(coll, a, b)
+		})
+	}
+
+	return false
+}
+
+// indexOfValue is the index of the first item equal to value, or -1
+func indexOfValue(coll *Collation, arr []any, value any) int {
+	return slices.IndexFunc(arr, func(item any) bool {
+		return valuesEqual(coll, item, value)
+	})
+}
+
+// valueSet finds values equal to a value by valuesEqual. Without a
+// collation values are bucketed by hashKey and only compared within their
+// bucket, with one strings equal under the collation may have different
+// keys and every value is compared.
+type valueSet struct {
+	coll    *Collation
+	values  []any
+	buckets map[string][]any
+}
+
+func newValueSet(coll *Collation) *valueSet {
+	set := &valueSet{coll: coll}
+	if coll == nil {
+		set.buckets = map[string][]any{}
+	}
+	return set
+}
+
+// add adds value to the set, every comparison is a step
+func (s *valueSet) add(ctx *EvalContext, value any) (bool, error) {
+	found, err := s.contains(ctx, value)
+	if err != nil || found {
+		return false, err
+	}
+
+	if s.buckets != nil {
+		key := hashKey(value)
+		s.buckets[key] = append(s.buckets[key], value)
+	} else {
+		s.values = append(s.values, value)
+	}
+	return true, nil
+}
+
+// contains reports whether the set has a value equal to value, every
+// comparison is a step
+func (s *valueSet) contains(ctx *EvalContext, value any) (bool, error) {
+	candidates := s.values
+	if s.buckets != nil {
+		candidates = s.buckets[hashKey(value)]
+	}
+
+	if err := ctx.charge(len(candidates) + 1); err != nil {
+		return false, err
+	}
+
+	return indexOfValue(s.coll, candidates, value) >= 0, nil
+}
+
+// hashKey is a key of a value that is the same for all values equal to it
+// by valuesEqual without a collation. Numbers are keyed by their nearest
+// float64, so numbers that differ only beyond it share a bucket.
+func hashKey(value any) string {
+	var sb strings.Builder
+	writeHashKey(&sb, value)
+	return sb.String()
+}
+
+func writeHashKey(sb *strings.Builder, value any) {
+	if isNumber(value) {
+		f, native := nativeFloat(value)
+		if !native {
+			f, _ = value.(*big.Float).Float64()
+		}
+		if f == 0 {
+			// -0 equals 0
+			f = 0
+		}
+		sb.WriteByte('n')
+		sb.WriteString(strconv.FormatFloat(f, 'g', -1, 64))
+		return
+	}
+
+	switch v := value.(type) {
+	case nil:
+		sb.WriteByte('z')
+	case bool:
+		sb.WriteString(strconv.FormatBool(v))
+	case string:
+		sb.WriteString(strconv.Quote(v))
+	case time.Time:
+		sb.WriteByte('t')
+		sb.WriteString(strconv.FormatInt(v.Unix(), 10))
+		sb.WriteByte('.')
+		sb.WriteString(strconv.Itoa(v.Nanosecond()))
+	case time.Duration:
+		sb.WriteByte('d')
+		sb.WriteString(strconv.FormatInt(int64(v), 10))
+	case []any:
+		sb.WriteByte('[')
+		for _, item := range v {
+			writeHashKey(sb, item)
+			sb.WriteByte(',')
+		}
+		sb.WriteByte(']')
+	case map[string]any:
+		sb.WriteByte('{')
+		for _, key := range sortedKeys(v) {
+			sb.WriteString(strconv.Quote(key))
+			sb.WriteByte(':')
+			writeHashKey(sb, v[key])
+			sb.WriteByte(',')
+		}
+		sb.WriteByte('}')
+	default:
+		sb.WriteByte('?')
+	}
+}
+
+// sortedKeys lists the keys of an object in sorted order
+func sortedKeys(obj map[string]any) []string {
+	return slices.Sorted(maps.Keys(obj))
+}
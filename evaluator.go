@@ -2,41 +2,72 @@ package yap
 
 import (
 	"encoding/json"
+	"math/big"
 	"strings"
+	"time"
 )
 
-type EvalContext struct {
-	Json    any
-	FuncMap map[string]Function
-}
-
+// Evaluator is a parsed expression compiled for the VM, it is safe for
+// concurrent use
 type Evaluator struct {
 	expression Expr
+	program    *program
+	// optimized is the program of the optimized expression, used by
+	// evaluations with the settings constants were folded with
+	optimized *program
+	// paths are the parts of the document the expression reads, the only
+	// ones decoded
+	paths *pathTree
 }
 
-func (e *Evaluator) Eval(data string) (interface{}, error) {
-	var js map[string]any
-	err := json.Unmarshal([]byte(data), &js)
+func (e *Evaluator) Eval(data string, opts ...EvalOption) (interface{}, error) {
+	return e.evalBytes([]byte(data), opts)
+}
+
+func (e *Evaluator) evalBytes(data []byte, opts []EvalOption) (interface{}, error) {
+	js, err := decodeDocument(data, e.paths)
 
 	if err != nil {
 		return nil, err
 	}
 
-	return e.expression.Eval(&EvalContext{
+	ctx := newEvalContext(js, opts)
+
+	if foldable(ctx) {
+		return e.optimized.Eval(ctx)
+	}
+
+	return e.program.Eval(ctx)
+}
+
+// newEvalContext creates the root scope of an evaluation against js
+func newEvalContext(js any, opts []EvalOption) *EvalContext {
+	ctx := &EvalContext{
 		Json:    js,
 		FuncMap: BuiltinFunctions,
-	})
+	}
+
+	for _, opt := range opts {
+		opt(ctx)
+	}
+
+	ctx.countSteps()
 
+	return ctx
 }
 
-func NewEvaluator(str string) (*Evaluator, error) {
+func NewEvaluator(str string, opts ...ParseOption) (*Evaluator, error) {
+	if limits := newParseLimits(opts); limits.maxLength > 0 && len(str) > limits.maxLength {
+		return nil, &LimitError{Limit: LengthLimit, Max: limits.maxLength}
+	}
+
 	tokens, err := Tokenize(strings.NewReader(str))
 
 	if err != nil {
 		return nil, err
 	}
 
-	parser := NewParser(tokens)
+	parser := NewParser(tokens, opts...)
 
 	expr, err := parser.Parse()
 
@@ -44,23 +75,46 @@ func NewEvaluator(str string) (*Evaluator, error) {
 		return nil, err
 	}
 
-	return &Evaluator{expression: expr}, nil
+	expr, err = compileRegexes(expr)
+
+	if err != nil {
+		return nil, err
+	}
+
+	program, err := compile(expr)
+
+	if err != nil {
+		return nil, err
+	}
+
+	optimized, err := compile(optimize(expr))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Evaluator{
+		expression: expr,
+		program:    program,
+		optimized:  optimized,
+		paths:      collectPaths(expr),
+	}, nil
 }
 
-func Evaluate(str string, data string) (interface{}, error) {
+func Evaluate(str string, data string, opts ...EvalOption) (interface{}, error) {
 	evaluator, err := NewEvaluator(str)
 
 	if err != nil {
 		return nil, err
 	}
 
-	result, err := evaluator.Eval(data)
+	result, err := evaluator.Eval(data, opts...)
 
 	if err != nil {
 		return nil, err
 	}
 
-	encoded, err := json.Marshal(result)
+	encoded, err := json.Marshal(toJSONValue(result))
 
 	if err != nil {
 		return nil, err
@@ -68,3 +122,37 @@ func Evaluate(str string, data string) (interface{}, error) {
 
 	return string(encoded), nil
 }
+
+// toJSONValue prepares an evaluation result for encoding, numbers are
+// written as JSON numbers rather than the quoted text of *big.Float
+func toJSONValue(value any) any {
+	switch v := value.(type) {
+	case undefined:
+		return nil
+	case *big.Float:
+		return json.Number(v.Text('g', -1))
+	case int64:
+		return json.Number(formatInt(v))
+	case int53:
+		return json.Number(formatInt(int64(v)))
+	case time.Duration:
+		return v.String()
+	case []any:
+		values := make([]any, len(v))
+		for i, item := range v {
+			values[i] = toJSONValue(item)
+		}
+		return values
+	case map[string]any:
+		object := make(map[string]any, len(v))
+		for key, item := range v {
+			if item == Undefined {
+				continue
+			}
+			object[key] = toJSONValue(item)
+		}
+		return object
+	}
+
+	return value
+}
@@ -0,0 +1,230 @@
+package yap
+
+import (
+	"testing"
+)
+
+const testJson = `{
+	"books": [
+		{"name": "Frankenstein", "author": "Mary Shelley", "year": 1818},
+		{"name": "1984", "author": "George Orwell", "year": 1949},
+		{"name": "Project Hail Mary 🌌", "author": "Andy Weir", "year": 2021}
+	],
+	"a": 1,
+	"b": "two"
+}`
+
+func TestEvaluateObjectConstructor(t *testing.T) {
+	result, err := Evaluate(`{ "title": $.books[0].name, "count": length($.books) }`, testJson)
+
+	if err != nil {
+		t.Fatalf("failed to evaluate: %v", err)
+	}
+
+	expect := `{"count":3,"title":"Frankenstein"}`
+	if result != expect {
+		t.Errorf("expected %s, got %s", expect, result)
+	}
+}
+
+func TestEvaluateArrayConstructor(t *testing.T) {
+	result, err := Evaluate(`[ $.a, $.b, [true, null], {} ]`, testJson)
+
+	if err != nil {
+		t.Fatalf("failed to evaluate: %v", err)
+	}
+
+	expect := `[1,"two",[true,null],{}]`
+	if result != expect {
+		t.Errorf("expected %s, got %s", expect, result)
+	}
+
+	// a comma followed by three digits may separate items or thousands
+	if _, err := Evaluate(`[100,200,300]`, testJson); err == nil {
+		t.Errorf("expected an ambiguous comma to fail")
+	}
+	if result, err := Evaluate(`[100, 200, 300]`, testJson); err != nil || result != `[100,200,300]` {
+		t.Errorf("expected three numbers, got %v %v", result, err)
+	}
+}
+
+func TestEvaluatePrecedence(t *testing.T) {
+	result, err := Evaluate(`length($.books) == 3 && ($.a > 0 || $.a < 0)`, testJson)
+
+	if err != nil {
+		t.Fatalf("failed to evaluate: %v", err)
+	}
+
+	if result != "true" {
+		t.Errorf("expected true, got %s", result)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []string{
+		`{ "a" $.a }`,
+		`[ $.a, $.b`,
+		`($.a == 1`,
+		`$.a $.b`,
+		``,
+	}
+
+	for _, test := range tests {
+		if _, err := NewEvaluator(test); err == nil {
+			t.Errorf("expected parse error for %q", test)
+		}
+	}
+}
+
+func TestShortCircuit(t *testing.T) {
+	data := `{"user": null, "admin": {"age": 30}}`
+
+	tests := []evaluateTest{
+		{`$.user != null && $.user.age > 18`, `false`},
+		{`$.user == null || $.user.age > 18`, `true`},
+		{`$.admin != null && $.admin.age > 18`, `true`},
+		// the right side would fail with an undefined function
+		{`false && missing()`, `false`},
+		{`true || missing()`, `true`},
+	}
+
+	runEvaluateTests(t, data, tests)
+
+	if _, err := Evaluate(`true && missing()`, data); err == nil {
+		t.Errorf("expected the right operand to be evaluated")
+	}
+}
+
+func TestMissingKeys(t *testing.T) {
+	data := `{"name": "bob", "tags": ["a"], "user": null}`
+
+	if _, err := Evaluate(`$.nickname == "bob"`, data); err == nil {
+		t.Errorf("expected missing key error by default")
+	}
+
+	runEvaluateTests(t, data, []evaluateTest{
+		{`exists($.name)`, `true`},
+		{`exists($.user)`, `true`},
+		{`exists($.nickname)`, `false`},
+		{`exists($.user.name)`, `false`},
+		{`exists($.tags[3])`, `false`},
+		{`has($, "name")`, `true`},
+		{`has($.tags, 0)`, `true`},
+		{`has($.tags, 1)`, `false`},
+	})
+
+	tests := []struct {
+		mode       MissingKeyMode
+		expression string
+		expect     string
+	}{
+		{MissingAsNull, `$.nickname == null`, `true`},
+		{MissingAsNull, `$.tags[3]`, `null`},
+		{MissingAsNull, `$.user.name`, `null`},
+		{MissingAsUndefined, `$.nickname == null`, `false`},
+		{MissingAsUndefined, `$.nickname != "bob"`, `false`},
+		{MissingAsUndefined, `$.tags[3] != 1`, `false`},
+		{MissingAsUndefined, `{ "a": $.name, "b": $.nickname }`, `{"a":"bob"}`},
+	}
+
+	for _, test := range tests {
+		result, err := Evaluate(test.expression, data, WithMissingKeys(test.mode))
+
+		if err != nil {
+			t.Errorf("%s: failed to evaluate: %v", test.expression, err)
+			continue
+		}
+
+		if result != test.expect {
+			t.Errorf("%s: expected %s, got %s", test.expression, test.expect, result)
+		}
+	}
+}
+
+func TestCoalesce(t *testing.T) {
+	data := `{"name": "bob", "nickname": null, "count": 0}`
+
+	runEvaluateTests(t, data, []evaluateTest{
+		{`($.nickname ?? $.name) == "bob"`, `true`},
+		{`$.alias ?? $.nickname ?? $.name`, `"bob"`},
+		{`$.count ?? 5`, `0`},
+		{`$.name ?? missing()`, `"bob"`},
+		{`$.alias ?? 1 == 1`, `true`},
+		{`coalesce($.alias, $.nickname, $.name)`, `"bob"`},
+		{`coalesce($.alias, $.nickname)`, `null`},
+		{`default($.alias.first, "none")`, `"none"`},
+		{`default($.name, "none")`, `"bob"`},
+	})
+}
+
+func TestConditional(t *testing.T) {
+	data := `{"score": 75, "vip": true}`
+
+	runEvaluateTests(t, data, []evaluateTest{
+		{`$.score > 50 ? "pass" : "fail"`, `"pass"`},
+		{`$.score > 90 ? "a" : $.score > 70 ? "b" : "c"`, `"b"`},
+		{`$.vip && $.score > 80 ? 10 : 0`, `0`},
+		{`{ "tier": $.vip ? "gold" : "basic" }`, `{"tier":"gold"}`},
+		{`$.vip ? 1 : missing()`, `1`},
+		{`if($.vip, "gold", missing())`, `"gold"`},
+		{`if($.score < 10, "low")`, `null`},
+	})
+}
+
+func TestDeepEquality(t *testing.T) {
+	data := `{
+		"a": {"x": [1, 2, {"y": null}]},
+		"b": {"x": [1, 2.0, {"y": null}]},
+		"c": {"x": [1, 2]},
+		"n": 1
+	}`
+
+	runEvaluateTests(t, data, []evaluateTest{
+		{`$.a == $.b`, `true`},
+		{`$.a != $.c`, `true`},
+		{`$.a.x == [1, 2, { "y": null }]`, `true`},
+		{`$.c.x == [1, 2, 3]`, `false`},
+		{`equals($.n, 1)`, `true`},
+		{`equals($.n, 1.000)`, `true`},
+		{`equals($.a, $.b)`, `true`},
+		{`$.n == "1"`, `false`},
+		{`[] == {}`, `false`},
+		{`null == null`, `true`},
+		{`unique([$.a, $.b, $.c])`, `[{"x":[1,2,{"y":null}]},{"x":[1,2]}]`},
+		{`contains([$.a], $.b)`, `true`},
+	})
+}
+
+func TestOrdering(t *testing.T) {
+	data := `{"name": "Bob", "date": "2024-05-17", "age": "20", "flag": true, "none": null}`
+
+	runEvaluateTests(t, data, []evaluateTest{
+		{`$.name < "M"`, `true`},
+		{`$.name > "Alice"`, `true`},
+		{`$.date < "2024-06-01"`, `true`},
+		{`$.date >= "2024-05-17"`, `true`},
+		{`false < $.flag`, `true`},
+		{`$.none <= null`, `true`},
+		{`$.none < null`, `false`},
+		{`[1, 2] < [1, 3]`, `true`},
+		{`min("b", "a")`, `"a"`},
+	})
+
+	mismatches := []string{
+		`$.age > 18`,
+		`$.flag > 0`,
+		`$.none < 1`,
+		`{} < {}`,
+	}
+
+	for _, expression := range mismatches {
+		if _, err := Evaluate(expression, data); err == nil {
+			t.Errorf("%s: expected a type mismatch error", expression)
+		}
+
+		result, err := Evaluate(expression, data, WithComparison(LenientComparison))
+		if err != nil || result != `false` {
+			t.Errorf("%s: expected lenient comparison to be false, got %v %v", expression, result, err)
+		}
+	}
+}
@@ -64,4 +64,13 @@ func main() {
 
 	log.Println(
 		yap.Evaluate(`largeNumber`, jsonData))
+
+	// build a new payload from the document
+	result6, err := yap.Evaluate(`{ "title": $.books[0].name, "count": length($.books), "firsts": [ $.numbers[0], $.elements[0].test[0] ] }`, jsonData)
+
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	log.Println("Result 6:", result6)
 }
@@ -2,11 +2,41 @@ package yap
 
 import (
 	"fmt"
+	"unicode/utf8"
 )
 
 type Function func(ctx *EvalContext, args []Expr) (interface{}, error)
 
+// PureFunctions marks the functions whose result only depends on the
+// values of their arguments, a call to one with constant arguments is
+// evaluated once by the optimizer. A function replaced in BuiltinFunctions
+// has to be removed from this set unless it is pure as well.
+var PureFunctions = map[string]bool{}
+
+// registerFunctions adds a group of functions to the builtin registry
+func registerFunctions(functions map[string]Function) {
+	for name, function := range functions {
+		BuiltinFunctions[name] = function
+	}
+}
+
+// registerPureFunctions adds a group of pure functions to the builtin registry
+func registerPureFunctions(functions map[string]Function) {
+	registerFunctions(functions)
+
+	for name := range functions {
+		PureFunctions[name] = true
+	}
+}
+
+func init() {
+	for _, name := range []string{"equals", "length", "exists", "coalesce", "default", "if", "has", "where"} {
+		PureFunctions[name] = true
+	}
+}
+
 var BuiltinFunctions = map[string]Function{
+	// equals(a, b) compares values structurally, like ==
 	"equals": func(ctx *EvalContext, args []Expr) (interface{}, error) {
 		if len(args) != 2 {
 			return nil, fmt.Errorf("equals function requires exactly 2 arguments")
@@ -19,7 +49,7 @@ var BuiltinFunctions = map[string]Function{
 		if err != nil {
 			return nil, err
 		}
-		return left == right, nil
+		return valuesEqual(ctx.Collation, left, right), nil
 	},
 
 	"length": func(ctx *EvalContext, args []Expr) (interface{}, error) {
@@ -31,17 +61,111 @@ var BuiltinFunctions = map[string]Function{
 			return nil, err
 		}
 
-		// we use big floats to represent numbers
+		// we use big floats to represent numbers, strings are
+		// measured in runes so multi-byte characters count once
 		switch v := value.(type) {
 		case string:
-			return NewFloatFromInt(len(v)), nil
+			return int64(utf8.RuneCountInString(v)), nil
 		case []interface{}:
-			return NewFloatFromInt(len(v)), nil
+			return int64(len(v)), nil
 		default:
 			return nil, fmt.Errorf("length function not supported for type %T", value)
 		}
 	},
 
+	// exists(path) is true when the path resolves, even to null
+	"exists": func(ctx *EvalContext, args []Expr) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("exists function requires exactly 1 argument")
+		}
+
+		value, err := args[0].Eval(lenient(ctx))
+		if err != nil {
+			return nil, err
+		}
+
+		return value != Undefined, nil
+	},
+
+	// coalesce(a, b, ...) returns the first argument that is neither null
+	// nor missing, later arguments are not evaluated
+	"coalesce": func(ctx *EvalContext, args []Expr) (interface{}, error) {
+		if len(args) == 0 {
+			return nil, fmt.Errorf("coalesce function requires at least 1 argument")
+		}
+
+		for _, arg := range args {
+			value, err := arg.Eval(lenient(ctx))
+			if err != nil {
+				return nil, err
+			}
+
+			if !isAbsent(value) {
+				return value, nil
+			}
+		}
+
+		return nil, nil
+	},
+
+	// default(x, v) returns v when x is null or missing, like x ?? v
+	"default": func(ctx *EvalContext, args []Expr) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, fmt.Errorf("default function requires exactly 2 arguments")
+		}
+
+		return (&BinOp{Left: args[0], Operator: "??", Right: args[1]}).Eval(ctx)
+	},
+
+	// if(cond, then, else) evaluates only the branch selected by cond,
+	// else may be omitted and defaults to null
+	"if": func(ctx *EvalContext, args []Expr) (interface{}, error) {
+		if len(args) != 2 && len(args) != 3 {
+			return nil, fmt.Errorf("if function requires 2 or 3 arguments")
+		}
+
+		otherwise := Expr(&NullLiteral{})
+		if len(args) == 3 {
+			otherwise = args[2]
+		}
+
+		return (&Conditional{Condition: args[0], Then: args[1], Else: otherwise}).Eval(ctx)
+	},
+
+	// has(obj, key) is true when obj contains key, or arr contains index
+	"has": func(ctx *EvalContext, args []Expr) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, fmt.Errorf("has function requires exactly 2 arguments")
+		}
+		container, err := args[0].Eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		key, err := args[1].Eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		switch v := container.(type) {
+		case map[string]any:
+			name, ok := key.(string)
+			if !ok {
+				return nil, fmt.Errorf("has function requires a string key for objects")
+			}
+			_, exists := v[name]
+			return exists, nil
+		case []any:
+			index, ok := toBigFloat(key)
+			if !ok || !index.IsInt() {
+				return nil, fmt.Errorf("has function requires an integer index for arrays")
+			}
+			i, _ := index.Int64()
+			return i >= 0 && i < int64(len(v)), nil
+		default:
+			return nil, fmt.Errorf("has function not supported for type %T", container)
+		}
+	},
+
 	"where": func(ctx *EvalContext, args []Expr) (interface{}, error) {
 		if len(args) != 2 {
 			return nil, fmt.Errorf("where function requires exactly 2 arguments")
@@ -57,39 +181,14 @@ var BuiltinFunctions = map[string]Function{
 			return nil, fmt.Errorf("where function requires a condition expression")
 		}
 
-		if conditionExpr.(*BinOp) == nil {
-			return nil, fmt.Errorf("where function requires a binary operation as condition")
-		}
-
 		arrSlice, ok := arr.([]interface{})
 
 		if !ok {
 			return nil, fmt.Errorf("where function requires first argument to be an array")
 		}
 
-		matches := []any{}
-		for _, item := range arrSlice {
-			// inject special @ identifier for iterative elements
-			jsonItem := map[string]any{
-				"@": item,
-			}
-
-			conditionCtx := &EvalContext{
-				Json:    jsonItem,
-				FuncMap: ctx.FuncMap,
-			}
-
-			result, err := conditionExpr.Eval(conditionCtx)
-
-			if err != nil {
-				return nil, err
-			}
-
-			if result.(bool) {
-				matches = append(matches, item)
-			}
-		}
-
-		return matches, nil
+		// the condition sees the iterated element as @, the root and any
+		// outer bindings remain visible to it
+		return filterItems(ctx, conditionExpr, arrSlice)
 	},
 }
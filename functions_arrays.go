@@ -0,0 +1,442 @@
+package yap
+
+import (
+	"fmt"
+	"math/bits"
+	"slices"
+	"strings"
+)
+
+func init() {
+	registerPureFunctions(arrayFunctions)
+}
+
+// uniqueValues keeps the first occurrence of every distinct value
+func uniqueValues(ctx *EvalContext, values []any) ([]any, error) {
+	seen := newValueSet(ctx.Collation)
+	unique := []any{}
+
+	for _, value := range values {
+		added, err := seen.add(ctx, value)
+		if err != nil {
+			return nil, err
+		}
+		if added {
+			unique = append(unique, value)
+		}
+	}
+
+	return unique, nil
+}
+
+// valueSets builds a valueSet of each array
+func valueSets(ctx *EvalContext, arrs [][]any) ([]*valueSet, error) {
+	sets := make([]*valueSet, len(arrs))
+
+	for i, arr := range arrs {
+		sets[i] = newValueSet(ctx.Collation)
+		for _, value := range arr {
+			if _, err := sets[i].add(ctx, value); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return sets, nil
+}
+
+// findValue is indexOfValue counting the items searched as steps
+func findValue(ctx *EvalContext, arr []any, value any) (int, error) {
+	if err := ctx.charge(len(arr)); err != nil {
+		return -1, err
+	}
+
+	return indexOfValue(ctx.Collation, arr, value), nil
+}
+
+// flattenValues expands nested arrays up to depth levels, a negative depth
+// flattens completely
+func flattenValues(values []any, depth int) []any {
+	flat := []any{}
+
+	for _, value := range values {
+		if nested, ok := value.([]any); ok && depth != 0 {
+			flat = append(flat, flattenValues(nested, depth-1)...)
+			continue
+		}
+		flat = append(flat, value)
+	}
+
+	return flat
+}
+
+// sliceBounds resolves start and end indices, negative indices count from
+// the end and out of range indices are clamped, like JavaScript's slice
+func sliceBounds(length, start, end int) (int, int) {
+	resolve := func(i int) int {
+		if i < 0 {
+			i += length
+		}
+		return min(max(i, 0), length)
+	}
+
+	start, end = resolve(start), resolve(end)
+	return start, max(start, end)
+}
+
+// evalArrays evaluates all arguments of a function as arrays
+func evalArrays(ctx *EvalContext, name string, args []Expr) ([][]any, error) {
+	arrs := make([][]any, len(args))
+
+	for i, arg := range args {
+		value, err := arg.Eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		arr, ok := value.([]any)
+		if !ok {
+			return nil, fmt.Errorf("%s function requires array arguments, got %s", name, typeName(value))
+		}
+		arrs[i] = arr
+	}
+
+	return arrs, nil
+}
+
+// Membership and set operations use deep value equality, so objects,
+// arrays and numbers of any representation compare by value.
+var arrayFunctions = map[string]Function{
+	// sort(arr) is a stable sort, values of different types are ordered
+	// null < booleans < numbers < strings < times < durations < arrays < objects
+	"sort": func(ctx *EvalContext, args []Expr) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("sort function requires exactly 1 argument")
+		}
+		arr, err := evalArray(ctx, "sort", args[0])
+		if err != nil {
+			return nil, err
+		}
+
+		// a sort makes about n log n comparisons
+		if err := ctx.charge(len(arr) * bits.Len(uint(len(arr)))); err != nil {
+			return nil, err
+		}
+
+		sorted := slices.Clone(arr)
+		slices.SortStableFunc(sorted, func(a, b any) int {
+			return compareTotal(ctx.Collation, a, b)
+		})
+		return sorted, nil
+	},
+
+	"unique": func(ctx *EvalContext, args []Expr) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("unique function requires exactly 1 argument")
+		}
+		arr, err := evalArray(ctx, "unique", args[0])
+		if err != nil {
+			return nil, err
+		}
+		return uniqueValues(ctx, arr)
+	},
+
+	// flatten(arr, depth) expands nested arrays, depth defaults to 1 and
+	// -1 flattens completely
+	"flatten": func(ctx *EvalContext, args []Expr) (interface{}, error) {
+		if len(args) != 1 && len(args) != 2 {
+			return nil, fmt.Errorf("flatten function requires 1 or 2 arguments")
+		}
+		arr, err := evalArray(ctx, "flatten", args[0])
+		if err != nil {
+			return nil, err
+		}
+
+		depth := 1
+		if len(args) == 2 {
+			if depth, err = evalInt(ctx, "flatten", args[1]); err != nil {
+				return nil, err
+			}
+		}
+
+		flat := flattenValues(arr, depth)
+		if err := ctx.charge(len(flat)); err != nil {
+			return nil, err
+		}
+		return flat, nil
+	},
+
+	// reverse(x) reverses an array or the runes of a string
+	"reverse": func(ctx *EvalContext, args []Expr) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("reverse function requires exactly 1 argument")
+		}
+		value, err := args[0].Eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		switch v := value.(type) {
+		case []any:
+			if err := ctx.charge(len(v)); err != nil {
+				return nil, err
+			}
+
+			reversed := slices.Clone(v)
+			slices.Reverse(reversed)
+			return reversed, nil
+		case string:
+			runes := []rune(v)
+			slices.Reverse(runes)
+			return string(runes), nil
+		default:
+			return nil, fmt.Errorf("reverse function not supported for type %s", typeName(value))
+		}
+	},
+
+	// slice(x, start, end) takes part of an array or the runes of a
+	// string, end defaults to the length and negative indices count from
+	// the end
+	"slice": func(ctx *EvalContext, args []Expr) (interface{}, error) {
+		if len(args) != 2 && len(args) != 3 {
+			return nil, fmt.Errorf("slice function requires 2 or 3 arguments")
+		}
+		value, err := args[0].Eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		start, err := evalInt(ctx, "slice", args[1])
+		if err != nil {
+			return nil, err
+		}
+
+		var runes []rune
+		arr, isArray := value.([]any)
+
+		if str, ok := value.(string); ok {
+			runes = []rune(str)
+		} else if !isArray {
+			return nil, fmt.Errorf("slice function not supported for type %s", typeName(value))
+		}
+
+		length := len(arr)
+		if !isArray {
+			length = len(runes)
+		}
+
+		end := length
+		if len(args) == 3 {
+			if end, err = evalInt(ctx, "slice", args[2]); err != nil {
+				return nil, err
+			}
+		}
+
+		start, end = sliceBounds(length, start, end)
+
+		if err := ctx.charge(end - start); err != nil {
+			return nil, err
+		}
+
+		if isArray {
+			return slices.Clone(arr[start:end]), nil
+		}
+		return string(runes[start:end]), nil
+	},
+
+	// first(arr) and last(arr) are null for an empty array
+	"first": func(ctx *EvalContext, args []Expr) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("first function requires exactly 1 argument")
+		}
+		arr, err := evalArray(ctx, "first", args[0])
+		if err != nil || len(arr) == 0 {
+			return nil, err
+		}
+		return arr[0], nil
+	},
+
+	"last": func(ctx *EvalContext, args []Expr) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("last function requires exactly 1 argument")
+		}
+		arr, err := evalArray(ctx, "last", args[0])
+		if err != nil || len(arr) == 0 {
+			return nil, err
+		}
+		return arr[len(arr)-1], nil
+	},
+
+	// contains(arr, value) tests membership, contains(str, sub) tests for
+	// a substring
+	"contains": func(ctx *EvalContext, args []Expr) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, fmt.Errorf("contains function requires exactly 2 arguments")
+		}
+		container, err := args[0].Eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		value, err := args[1].Eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		switch c := container.(type) {
+		case []any:
+			i, err := findValue(ctx, c, value)
+			return i >= 0, err
+		case string:
+			sub, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("contains function requires a string to search a string, got %s", typeName(value))
+			}
+			return strings.Contains(c, sub), nil
+		default:
+			return nil, fmt.Errorf("contains function not supported for type %s", typeName(container))
+		}
+	},
+
+	// in(value, arr) is contains with the arguments swapped
+	"in": func(ctx *EvalContext, args []Expr) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, fmt.Errorf("in function requires exactly 2 arguments")
+		}
+		value, err := args[0].Eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		container, err := args[1].Eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		arr, ok := container.([]any)
+		if !ok {
+			return nil, fmt.Errorf("in function requires second argument to be an array")
+		}
+		i, err := findValue(ctx, arr, value)
+		return i >= 0, err
+	},
+
+	// indexOf(arr, value) is the index of the first equal item and
+	// indexOf(str, sub) the rune offset of the first sub, or -1
+	"indexOf": func(ctx *EvalContext, args []Expr) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, fmt.Errorf("indexOf function requires exactly 2 arguments")
+		}
+		container, err := args[0].Eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		value, err := args[1].Eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		switch c := container.(type) {
+		case []any:
+			i, err := findValue(ctx, c, value)
+			return int64(i), err
+		case string:
+			sub, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("indexOf function requires a string to search a string, got %s", typeName(value))
+			}
+			return int64(runeIndex(c, strings.Index(c, sub))), nil
+		default:
+			return nil, fmt.Errorf("indexOf function not supported for type %s", typeName(container))
+		}
+	},
+
+	// union(a, b, ...) is every distinct item of the arrays in order
+	"union": func(ctx *EvalContext, args []Expr) (interface{}, error) {
+		if len(args) < 2 {
+			return nil, fmt.Errorf("union function requires at least 2 arguments")
+		}
+		arrs, err := evalArrays(ctx, "union", args)
+		if err != nil {
+			return nil, err
+		}
+		return uniqueValues(ctx, slices.Concat(arrs...))
+	},
+
+	// intersect(a, b, ...) is the distinct items of a found in every other array
+	"intersect": func(ctx *EvalContext, args []Expr) (interface{}, error) {
+		if len(args) < 2 {
+			return nil, fmt.Errorf("intersect function requires at least 2 arguments")
+		}
+		arrs, err := evalArrays(ctx, "intersect", args)
+		if err != nil {
+			return nil, err
+		}
+
+		unique, err := uniqueValues(ctx, arrs[0])
+		if err != nil {
+			return nil, err
+		}
+		others, err := valueSets(ctx, arrs[1:])
+		if err != nil {
+			return nil, err
+		}
+
+		result := []any{}
+		for _, value := range unique {
+			found := true
+			for _, other := range others {
+				contains, err := other.contains(ctx, value)
+				if err != nil {
+					return nil, err
+				}
+				if !contains {
+					found = false
+					break
+				}
+			}
+
+			if found {
+				result = append(result, value)
+			}
+		}
+		return result, nil
+	},
+
+	// difference(a, b, ...) is the distinct items of a not found in any other array
+	"difference": func(ctx *EvalContext, args []Expr) (interface{}, error) {
+		if len(args) < 2 {
+			return nil, fmt.Errorf("difference function requires at least 2 arguments")
+		}
+		arrs, err := evalArrays(ctx, "difference", args)
+		if err != nil {
+			return nil, err
+		}
+
+		unique, err := uniqueValues(ctx, arrs[0])
+		if err != nil {
+			return nil, err
+		}
+		others, err := valueSets(ctx, arrs[1:])
+		if err != nil {
+			return nil, err
+		}
+
+		result := []any{}
+		for _, value := range unique {
+			found := false
+			for _, other := range others {
+				contains, err := other.contains(ctx, value)
+				if err != nil {
+					return nil, err
+				}
+				if contains {
+					found = true
+					break
+				}
+			}
+
+			if !found {
+				result = append(result, value)
+			}
+		}
+		return result, nil
+	},
+}
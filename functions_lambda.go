@@ -0,0 +1,269 @@
+package yap
+
+import (
+	"fmt"
+	"slices"
+)
+
+func init() {
+	registerPureFunctions(lambdaFunctions)
+}
+
+// scopeArgs lists per higher-order function the position of the first
+// argument evaluated in a child scope, where @ and lambda parameters are bound
+var scopeArgs = map[string]int{
+	"where":   1,
+	"map":     1,
+	"filter":  1,
+	"any":     1,
+	"all":     1,
+	"count":   1,
+	"reduce":  2,
+	"sortBy":  1,
+	"groupBy": 1,
+}
+
+// evalArray evaluates a function argument which must be an array
+func evalArray(ctx *EvalContext, name string, arg Expr) ([]any, error) {
+	value, err := arg.Eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	arr, ok := value.([]any)
+
+	if !ok {
+		return nil, fmt.Errorf("%s function requires first argument to be an array", name)
+	}
+
+	return arr, nil
+}
+
+// itemScope is the child scope a loop evaluates its expression in, one
+// scope is reused for every item by rebinding @, a lambda additionally
+// binds its parameter to the same value as @
+type itemScope struct {
+	ctx   *EvalContext
+	expr  Expr
+	param string
+}
+
+func newItemScope(ctx *EvalContext, expr Expr) (*itemScope, error) {
+	scope := &itemScope{ctx: ctx.NewScope(make(map[string]any, 2)), expr: expr}
+
+	if ctx.MaxDepth > 0 && scope.ctx.depth > ctx.MaxDepth {
+		return nil, &LimitError{Limit: DepthLimit, Max: ctx.MaxDepth}
+	}
+
+	if lambda, ok := expr.(*Lambda); ok {
+		scope.expr = lambda.Body
+		scope.param = lambda.Param
+	}
+
+	return scope, nil
+}
+
+// bind binds a name other than @, e.g. @acc
+func (s *itemScope) bind(name string, value any) {
+	s.ctx.Locals[name] = value
+}
+
+// eval evaluates the expression with @ bound to item, $ still refers to
+// the root, every item is a step of the evaluation
+func (s *itemScope) eval(item any) (any, error) {
+	if err := s.ctx.step(); err != nil {
+		return nil, err
+	}
+
+	s.ctx.Locals["@"] = item
+	if s.param != "" {
+		s.ctx.Locals[s.param] = item
+	}
+
+	return s.expr.Eval(s.ctx)
+}
+
+var lambdaFunctions = map[string]Function{
+	// map(arr, expr) projects every item through expr
+	"map": func(ctx *EvalContext, args []Expr) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, fmt.Errorf("map function requires exactly 2 arguments")
+		}
+		arr, err := evalArray(ctx, "map", args[0])
+		if err != nil {
+			return nil, err
+		}
+
+		return evalItems(ctx, args[1], arr)
+	},
+
+	// filter(arr, cond) keeps the items for which cond is true
+	"filter": func(ctx *EvalContext, args []Expr) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, fmt.Errorf("filter function requires exactly 2 arguments")
+		}
+		arr, err := evalArray(ctx, "filter", args[0])
+		if err != nil {
+			return nil, err
+		}
+
+		return filterItems(ctx, args[1], arr)
+	},
+
+	// any(arr, cond) is true when cond holds for at least one item
+	"any": func(ctx *EvalContext, args []Expr) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, fmt.Errorf("any function requires exactly 2 arguments")
+		}
+		arr, err := evalArray(ctx, "any", args[0])
+		if err != nil {
+			return nil, err
+		}
+
+		scope, err := newItemScope(ctx, args[1])
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range arr {
+			result, err := scope.eval(item)
+			if err != nil {
+				return nil, err
+			}
+
+			if toBoolean(result) {
+				return true, nil
+			}
+		}
+
+		return false, nil
+	},
+
+	// all(arr, cond) is true when cond holds for every item
+	"all": func(ctx *EvalContext, args []Expr) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, fmt.Errorf("all function requires exactly 2 arguments")
+		}
+		arr, err := evalArray(ctx, "all", args[0])
+		if err != nil {
+			return nil, err
+		}
+
+		scope, err := newItemScope(ctx, args[1])
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range arr {
+			result, err := scope.eval(item)
+			if err != nil {
+				return nil, err
+			}
+
+			if !toBoolean(result) {
+				return false, nil
+			}
+		}
+
+		return true, nil
+	},
+
+	// reduce(arr, init, expr) folds the items, expr sees the item as @
+	// and the accumulated value as @acc
+	"reduce": func(ctx *EvalContext, args []Expr) (interface{}, error) {
+		if len(args) != 3 {
+			return nil, fmt.Errorf("reduce function requires exactly 3 arguments")
+		}
+		arr, err := evalArray(ctx, "reduce", args[0])
+		if err != nil {
+			return nil, err
+		}
+
+		acc, err := args[1].Eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		scope, err := newItemScope(ctx, args[2])
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range arr {
+			scope.bind("@acc", acc)
+
+			if acc, err = scope.eval(item); err != nil {
+				return nil, err
+			}
+		}
+
+		return acc, nil
+	},
+
+	// sortBy(arr, key) stable sorts the items by the value of key, keys
+	// of different types are ordered as in sort
+	"sortBy": func(ctx *EvalContext, args []Expr) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, fmt.Errorf("sortBy function requires exactly 2 arguments")
+		}
+		arr, err := evalArray(ctx, "sortBy", args[0])
+		if err != nil {
+			return nil, err
+		}
+
+		type keyed struct {
+			key  any
+			item any
+		}
+
+		keys, err := evalItems(ctx, args[1], arr)
+		if err != nil {
+			return nil, err
+		}
+
+		items := make([]keyed, len(arr))
+		for i, item := range arr {
+			items[i] = keyed{key: keys[i], item: item}
+		}
+
+		slices.SortStableFunc(items, func(a, b keyed) int {
+			return compareTotal(ctx.Collation, a.key, b.key)
+		})
+
+		sorted := make([]any, len(items))
+		for i, item := range items {
+			sorted[i] = item.item
+		}
+
+		return sorted, nil
+	},
+
+	// groupBy(arr, key) builds an object of arrays keyed by the value of key
+	"groupBy": func(ctx *EvalContext, args []Expr) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, fmt.Errorf("groupBy function requires exactly 2 arguments")
+		}
+		arr, err := evalArray(ctx, "groupBy", args[0])
+		if err != nil {
+			return nil, err
+		}
+
+		values, err := evalItems(ctx, args[1], arr)
+		if err != nil {
+			return nil, err
+		}
+
+		groups := map[string]any{}
+		for i, item := range arr {
+			key, err := keyString(values[i])
+			if err != nil {
+				return nil, fmt.Errorf("groupBy function: %w", err)
+			}
+
+			group, _ := groups[key].([]any)
+			groups[key] = append(group, item)
+		}
+
+		return groups, nil
+	},
+}
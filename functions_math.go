@@ -0,0 +1,363 @@
+package yap
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+)
+
+func init() {
+	registerPureFunctions(mathFunctions)
+}
+
+// evalNumber evaluates a function argument which must be a number
+func evalNumber(ctx *EvalContext, name string, arg Expr) (*big.Float, error) {
+	value, err := arg.Eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	num, ok := toBigFloat(value)
+
+	if !ok {
+		return nil, fmt.Errorf("%s function requires a number argument, got %T", name, value)
+	}
+
+	return num, nil
+}
+
+// evalValues evaluates the arguments of a variadic aggregate, a single
+// array argument is expanded into its items, e.g. max(1, 2) or max($.a)
+func evalValues(ctx *EvalContext, name string, args []Expr) ([]any, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("%s function requires at least 1 argument", name)
+	}
+
+	values := make([]any, 0, len(args))
+	for _, arg := range args {
+		value, err := arg.Eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+
+	if arr, ok := values[0].([]any); ok && len(values) == 1 {
+		if err := ctx.charge(len(arr)); err != nil {
+			return nil, err
+		}
+		return arr, nil
+	}
+
+	return values, nil
+}
+
+// evalNumbers is evalValues for aggregates that only accept numbers
+func evalNumbers(ctx *EvalContext, name string, args []Expr) ([]*big.Float, error) {
+	values, err := evalValues(ctx, name, args)
+	if err != nil {
+		return nil, err
+	}
+
+	nums := make([]*big.Float, len(values))
+	for i, value := range values {
+		num, ok := toBigFloat(value)
+		if !ok {
+			return nil, fmt.Errorf("%s function requires numbers, got %T", name, value)
+		}
+		nums[i] = num
+	}
+
+	return nums, nil
+}
+
+// extreme returns the smallest (sign -1) or largest (sign 1) value
+func extreme(ctx *EvalContext, name string, args []Expr, sign int) (interface{}, error) {
+	values, err := evalValues(ctx, name, args)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	result := values[0]
+	for _, value := range values[1:] {
+		cmp, err := compareOrdered(ctx.Collation, value, result)
+		if err != nil {
+			return nil, fmt.Errorf("%s function: %w", name, err)
+		}
+
+		if cmp == sign {
+			result = value
+		}
+	}
+
+	return result, nil
+}
+
+// roundToInteger rounds x to an integral value according to mode
+func roundToInteger(x *big.Float, mode big.RoundingMode) *big.Float {
+	if x.IsInt() || x.IsInf() {
+		return new(big.Float).Copy(x)
+	}
+
+	// truncate towards zero, then decide whether to step away from it
+	integer, _ := x.Int(nil)
+	truncated := new(big.Float).SetPrec(x.Prec()).SetInt(integer)
+
+	fraction := new(big.Float).Sub(x, truncated)
+	half := fraction.Abs(fraction).Cmp(big.NewFloat(0.5))
+
+	away := false
+	switch mode {
+	case big.ToZero:
+	case big.AwayFromZero:
+		away = true
+	case big.ToNegativeInf:
+		away = x.Sign() < 0
+	case big.ToPositiveInf:
+		away = x.Sign() > 0
+	case big.ToNearestAway:
+		away = half >= 0
+	default: // big.ToNearestEven
+		away = half > 0 || (half == 0 && integer.Bit(0) == 1)
+	}
+
+	if away {
+		step := big.NewFloat(float64(x.Sign()))
+		truncated.Add(truncated, step)
+	}
+
+	return truncated
+}
+
+var mathFunctions = map[string]Function{
+	"sum": func(ctx *EvalContext, args []Expr) (interface{}, error) {
+		nums, err := evalNumbers(ctx, "sum", args)
+		if err != nil {
+			return nil, err
+		}
+
+		total := ctx.newFloat()
+		for _, num := range nums {
+			total.Add(total, num)
+		}
+		return total, nil
+	},
+
+	// avg of no values is null
+	"avg": func(ctx *EvalContext, args []Expr) (interface{}, error) {
+		nums, err := evalNumbers(ctx, "avg", args)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(nums) == 0 {
+			return nil, nil
+		}
+
+		total := ctx.newFloat()
+		for _, num := range nums {
+			total.Add(total, num)
+		}
+		return total.Quo(total, NewFloatFromInt(len(nums))), nil
+	},
+
+	// min and max compare values like <, of no values they are null
+	"min": func(ctx *EvalContext, args []Expr) (interface{}, error) {
+		return extreme(ctx, "min", args, -1)
+	},
+
+	"max": func(ctx *EvalContext, args []Expr) (interface{}, error) {
+		return extreme(ctx, "max", args, 1)
+	},
+
+	// count(arr) is the number of items, count(arr, cond) the number of
+	// items for which cond is true
+	"count": func(ctx *EvalContext, args []Expr) (interface{}, error) {
+		if len(args) != 1 && len(args) != 2 {
+			return nil, fmt.Errorf("count function requires 1 or 2 arguments")
+		}
+		arr, err := evalArray(ctx, "count", args[0])
+		if err != nil {
+			return nil, err
+		}
+
+		if len(args) == 1 {
+			return int64(len(arr)), nil
+		}
+
+		results, err := evalItems(ctx, args[1], arr)
+		if err != nil {
+			return nil, err
+		}
+
+		count := 0
+		for _, result := range results {
+			if toBoolean(result) {
+				count++
+			}
+		}
+		return int64(count), nil
+	},
+
+	"abs": func(ctx *EvalContext, args []Expr) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("abs function requires exactly 1 argument")
+		}
+		num, err := evalNumber(ctx, "abs", args[0])
+		if err != nil {
+			return nil, err
+		}
+		return ctx.newFloat().Abs(num), nil
+	},
+
+	"floor": func(ctx *EvalContext, args []Expr) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("floor function requires exactly 1 argument")
+		}
+		num, err := evalNumber(ctx, "floor", args[0])
+		if err != nil {
+			return nil, err
+		}
+		return roundToInteger(num, big.ToNegativeInf), nil
+	},
+
+	"ceil": func(ctx *EvalContext, args []Expr) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("ceil function requires exactly 1 argument")
+		}
+		num, err := evalNumber(ctx, "ceil", args[0])
+		if err != nil {
+			return nil, err
+		}
+		return roundToInteger(num, big.ToPositiveInf), nil
+	},
+
+	// round(x, digits) rounds to digits decimal places using the context
+	// rounding mode, digits defaults to 0 and may be negative
+	"round": func(ctx *EvalContext, args []Expr) (interface{}, error) {
+		if len(args) != 1 && len(args) != 2 {
+			return nil, fmt.Errorf("round function requires 1 or 2 arguments")
+		}
+		num, err := evalNumber(ctx, "round", args[0])
+		if err != nil {
+			return nil, err
+		}
+
+		digits := 0
+		if len(args) == 2 {
+			if digits, err = evalInt(ctx, "round", args[1]); err != nil {
+				return nil, err
+			}
+		}
+
+		// the scale is a power of ten with |digits| digits
+		if abs(digits) > maxRoundDigits {
+			return nil, fmt.Errorf("round function supports at most %d digits", maxRoundDigits)
+		}
+
+		// scale by a power of ten with extra precision so the decimal
+		// digits survive the binary representation
+		prec := max(num.Prec(), ctx.Precision, 64) + 64
+		scale := new(big.Float).SetPrec(prec).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(digits))), nil))
+
+		scaled := new(big.Float).SetPrec(prec)
+		if digits >= 0 {
+			scaled.Mul(num, scale)
+		} else {
+			scaled.Quo(num, scale)
+		}
+
+		rounded := roundToInteger(scaled, ctx.Rounding)
+
+		result := ctx.newFloat()
+		if digits >= 0 {
+			return result.Quo(rounded, scale), nil
+		}
+		return result.Mul(rounded, scale), nil
+	},
+
+	// pow(x, y) is exact for integral exponents, otherwise computed in
+	// float64 precision
+	"pow": func(ctx *EvalContext, args []Expr) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, fmt.Errorf("pow function requires exactly 2 arguments")
+		}
+		base, err := evalNumber(ctx, "pow", args[0])
+		if err != nil {
+			return nil, err
+		}
+		exponent, err := evalNumber(ctx, "pow", args[1])
+		if err != nil {
+			return nil, err
+		}
+
+		if exponent.IsInt() {
+			n, accuracy := exponent.Int64()
+			if accuracy != big.Exact {
+				return nil, fmt.Errorf("pow function exponent is too large")
+			}
+
+			if n < 0 && base.Sign() == 0 {
+				return nil, fmt.Errorf("division by zero")
+			}
+
+			result := ctx.newFloat().SetInt64(1)
+			square := ctx.newFloat().Set(base)
+			for e := uint64(abs(n)); e > 0; e >>= 1 {
+				if e&1 == 1 {
+					result.Mul(result, square)
+				}
+				square.Mul(square, square)
+			}
+
+			if n < 0 {
+				result.Quo(ctx.newFloat().SetInt64(1), result)
+			}
+
+			// the exponent of a *big.Float overflows to infinity
+			if result.IsInf() {
+				return nil, fmt.Errorf("pow function result is not a finite number")
+			}
+			return result, nil
+		}
+
+		b, _ := base.Float64()
+		e, _ := exponent.Float64()
+		result := math.Pow(b, e)
+
+		if math.IsNaN(result) || math.IsInf(result, 0) {
+			return nil, fmt.Errorf("pow function result is not a finite number")
+		}
+		return ctx.newFloat().SetFloat64(result), nil
+	},
+
+	"sqrt": func(ctx *EvalContext, args []Expr) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("sqrt function requires exactly 1 argument")
+		}
+		num, err := evalNumber(ctx, "sqrt", args[0])
+		if err != nil {
+			return nil, err
+		}
+
+		if num.Sign() < 0 {
+			return nil, fmt.Errorf("sqrt function requires a non-negative number")
+		}
+		return ctx.newFloat().Sqrt(num), nil
+	},
+}
+
+// maxRoundDigits bounds the decimal places of round, more than a float64
+// or a precise *big.Float can show
+const maxRoundDigits = 400
+
+func abs[T int | int64](x T) T {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
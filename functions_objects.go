@@ -0,0 +1,205 @@
+package yap
+
+import (
+	"fmt"
+	"maps"
+)
+
+func init() {
+	registerPureFunctions(objectFunctions)
+}
+
+// evalObject evaluates a function argument which must be an object, every
+// entry the function works through is a step
+func evalObject(ctx *EvalContext, name string, arg Expr) (map[string]any, error) {
+	value, err := arg.Eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	obj, ok := value.(map[string]any)
+
+	if !ok {
+		return nil, fmt.Errorf("%s function requires an object argument, got %s", name, typeName(value))
+	}
+
+	if err := ctx.charge(len(obj)); err != nil {
+		return nil, err
+	}
+
+	return obj, nil
+}
+
+// evalKeys evaluates the key arguments of pick and omit, each argument is
+// either a string or an array of strings
+func evalKeys(ctx *EvalContext, name string, args []Expr) (map[string]bool, error) {
+	keys := map[string]bool{}
+
+	for _, arg := range args {
+		value, err := arg.Eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		values, ok := value.([]any)
+		if !ok {
+			values = []any{value}
+		}
+
+		for _, key := range values {
+			str, ok := key.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s function requires string keys, got %s", name, typeName(key))
+			}
+			keys[str] = true
+		}
+	}
+
+	return keys, nil
+}
+
+// filterKeys copies the entries of obj whose key presence in keys is keep
+func filterKeys(obj map[string]any, keys map[string]bool, keep bool) map[string]any {
+	result := map[string]any{}
+
+	for key, value := range obj {
+		if keys[key] == keep {
+			result[key] = value
+		}
+	}
+
+	return result
+}
+
+// Keys are always returned in sorted order so results are deterministic
+var objectFunctions = map[string]Function{
+	"keys": func(ctx *EvalContext, args []Expr) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("keys function requires exactly 1 argument")
+		}
+		obj, err := evalObject(ctx, "keys", args[0])
+		if err != nil {
+			return nil, err
+		}
+
+		keys := []any{}
+		for _, key := range sortedKeys(obj) {
+			keys = append(keys, key)
+		}
+		return keys, nil
+	},
+
+	// values(obj) lists the values in key order
+	"values": func(ctx *EvalContext, args []Expr) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("values function requires exactly 1 argument")
+		}
+		obj, err := evalObject(ctx, "values", args[0])
+		if err != nil {
+			return nil, err
+		}
+
+		values := []any{}
+		for _, key := range sortedKeys(obj) {
+			values = append(values, obj[key])
+		}
+		return values, nil
+	},
+
+	// entries(obj) lists [key, value] pairs in key order
+	"entries": func(ctx *EvalContext, args []Expr) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("entries function requires exactly 1 argument")
+		}
+		obj, err := evalObject(ctx, "entries", args[0])
+		if err != nil {
+			return nil, err
+		}
+
+		entries := []any{}
+		for _, key := range sortedKeys(obj) {
+			entries = append(entries, []any{key, obj[key]})
+		}
+		return entries, nil
+	},
+
+	// fromEntries(arr) builds an object from [key, value] pairs, a
+	// repeated key takes the last value
+	"fromEntries": func(ctx *EvalContext, args []Expr) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("fromEntries function requires exactly 1 argument")
+		}
+		arr, err := evalArray(ctx, "fromEntries", args[0])
+		if err != nil {
+			return nil, err
+		}
+
+		if err := ctx.charge(len(arr)); err != nil {
+			return nil, err
+		}
+
+		obj := map[string]any{}
+		for _, item := range arr {
+			pair, ok := item.([]any)
+			if !ok || len(pair) != 2 {
+				return nil, fmt.Errorf("fromEntries function requires [key, value] pairs")
+			}
+
+			key, err := keyString(pair[0])
+			if err != nil {
+				return nil, fmt.Errorf("fromEntries function: %w", err)
+			}
+			obj[key] = pair[1]
+		}
+		return obj, nil
+	},
+
+	// merge(a, b, ...) shallow merges objects, later keys win
+	"merge": func(ctx *EvalContext, args []Expr) (interface{}, error) {
+		if len(args) == 0 {
+			return nil, fmt.Errorf("merge function requires at least 1 argument")
+		}
+
+		merged := map[string]any{}
+		for _, arg := range args {
+			obj, err := evalObject(ctx, "merge", arg)
+			if err != nil {
+				return nil, err
+			}
+			maps.Copy(merged, obj)
+		}
+		return merged, nil
+	},
+
+	// pick(obj, "a", "b") keeps only the given keys
+	"pick": func(ctx *EvalContext, args []Expr) (interface{}, error) {
+		if len(args) < 2 {
+			return nil, fmt.Errorf("pick function requires at least 2 arguments")
+		}
+		obj, err := evalObject(ctx, "pick", args[0])
+		if err != nil {
+			return nil, err
+		}
+		keys, err := evalKeys(ctx, "pick", args[1:])
+		if err != nil {
+			return nil, err
+		}
+		return filterKeys(obj, keys, true), nil
+	},
+
+	// omit(obj, "a", "b") drops the given keys
+	"omit": func(ctx *EvalContext, args []Expr) (interface{}, error) {
+		if len(args) < 2 {
+			return nil, fmt.Errorf("omit function requires at least 2 arguments")
+		}
+		obj, err := evalObject(ctx, "omit", args[0])
+		if err != nil {
+			return nil, err
+		}
+		keys, err := evalKeys(ctx, "omit", args[1:])
+		if err != nil {
+			return nil, err
+		}
+		return filterKeys(obj, keys, false), nil
+	},
+}
@@ -0,0 +1,294 @@
+package yap
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+func init() {
+	registerPureFunctions(stringFunctions)
+}
+
+// evalString evaluates a function argument which must be a string
+func evalString(ctx *EvalContext, name string, arg Expr) (string, error) {
+	value, err := arg.Eval(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	str, ok := value.(string)
+
+	if !ok {
+		return "", fmt.Errorf("%s function requires a string argument, got %T", name, value)
+	}
+
+	return str, nil
+}
+
+// evalInt evaluates a function argument which must be an integral number
+func evalInt(ctx *EvalContext, name string, arg Expr) (int, error) {
+	value, err := arg.Eval(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	num, ok := toBigFloat(value)
+
+	if !ok || !num.IsInt() {
+		return 0, fmt.Errorf("%s function requires an integer argument, got %v", name, value)
+	}
+
+	i, _ := num.Int64()
+	return int(i), nil
+}
+
+// evalStrings evaluates all arguments of a function as strings
+func evalStrings(ctx *EvalContext, name string, args []Expr) ([]string, error) {
+	strs := make([]string, len(args))
+
+	for i, arg := range args {
+		str, err := evalString(ctx, name, arg)
+		if err != nil {
+			return nil, err
+		}
+		strs[i] = str
+	}
+
+	return strs, nil
+}
+
+// runeIndex converts a byte offset into a rune offset, keeping -1 as is
+func runeIndex(s string, byteIndex int) int {
+	if byteIndex < 0 {
+		return byteIndex
+	}
+	return utf8.RuneCountInString(s[:byteIndex])
+}
+
+// foldCase applies full Unicode case folding, so "Straße" and "STRASSE"
+// fold to the same string, and normalizes the result
+func foldCase(s string) string {
+	return norm.NFC.String(cases.Fold().String(s))
+}
+
+var stringFunctions = map[string]Function{
+	"lower": func(ctx *EvalContext, args []Expr) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("lower function requires exactly 1 argument")
+		}
+		str, err := evalString(ctx, "lower", args[0])
+		if err != nil {
+			return nil, err
+		}
+		return strings.ToLower(str), nil
+	},
+
+	"upper": func(ctx *EvalContext, args []Expr) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("upper function requires exactly 1 argument")
+		}
+		str, err := evalString(ctx, "upper", args[0])
+		if err != nil {
+			return nil, err
+		}
+		return strings.ToUpper(str), nil
+	},
+
+	// equalsFold(a, b) compares strings ignoring case, unlike lower(a) ==
+	// lower(b) it also matches "ß" with "SS"
+	"equalsFold": func(ctx *EvalContext, args []Expr) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, fmt.Errorf("equalsFold function requires exactly 2 arguments")
+		}
+		strs, err := evalStrings(ctx, "equalsFold", args)
+		if err != nil {
+			return nil, err
+		}
+		return foldCase(strs[0]) == foldCase(strs[1]), nil
+	},
+
+	// trim(s) removes surrounding whitespace, trim(s, chars) the given runes
+	"trim": func(ctx *EvalContext, args []Expr) (interface{}, error) {
+		if len(args) != 1 && len(args) != 2 {
+			return nil, fmt.Errorf("trim function requires 1 or 2 arguments")
+		}
+		strs, err := evalStrings(ctx, "trim", args)
+		if err != nil {
+			return nil, err
+		}
+		if len(strs) == 2 {
+			return strings.Trim(strs[0], strs[1]), nil
+		}
+		return strings.TrimSpace(strs[0]), nil
+	},
+
+	"startsWith": func(ctx *EvalContext, args []Expr) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, fmt.Errorf("startsWith function requires exactly 2 arguments")
+		}
+		strs, err := evalStrings(ctx, "startsWith", args)
+		if err != nil {
+			return nil, err
+		}
+		return strings.HasPrefix(strs[0], strs[1]), nil
+	},
+
+	"endsWith": func(ctx *EvalContext, args []Expr) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, fmt.Errorf("endsWith function requires exactly 2 arguments")
+		}
+		strs, err := evalStrings(ctx, "endsWith", args)
+		if err != nil {
+			return nil, err
+		}
+		return strings.HasSuffix(strs[0], strs[1]), nil
+	},
+
+	// substring(s, start, length) counts runes, length defaults to the rest
+	"substring": func(ctx *EvalContext, args []Expr) (interface{}, error) {
+		if len(args) != 2 && len(args) != 3 {
+			return nil, fmt.Errorf("substring function requires 2 or 3 arguments")
+		}
+		str, err := evalString(ctx, "substring", args[0])
+		if err != nil {
+			return nil, err
+		}
+		start, err := evalInt(ctx, "substring", args[1])
+		if err != nil {
+			return nil, err
+		}
+
+		runes := []rune(str)
+		if start < 0 {
+			return nil, fmt.Errorf("substring function requires a non-negative start")
+		}
+		start = min(start, len(runes))
+
+		end := len(runes)
+		if len(args) == 3 {
+			length, err := evalInt(ctx, "substring", args[2])
+			if err != nil {
+				return nil, err
+			}
+			if length < 0 {
+				return nil, fmt.Errorf("substring function requires a non-negative length")
+			}
+			// clamped before adding so a huge length cannot overflow
+			end = start + min(length, len(runes)-start)
+		}
+
+		return string(runes[start:end]), nil
+	},
+
+	"split": func(ctx *EvalContext, args []Expr) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, fmt.Errorf("split function requires exactly 2 arguments")
+		}
+		strs, err := evalStrings(ctx, "split", args)
+		if err != nil {
+			return nil, err
+		}
+
+		parts := strings.Split(strs[0], strs[1])
+		if err := ctx.charge(len(parts)); err != nil {
+			return nil, err
+		}
+
+		result := make([]any, len(parts))
+		for i, part := range parts {
+			result[i] = part
+		}
+		return result, nil
+	},
+
+	"join": func(ctx *EvalContext, args []Expr) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, fmt.Errorf("join function requires exactly 2 arguments")
+		}
+		arr, err := evalArray(ctx, "join", args[0])
+		if err != nil {
+			return nil, err
+		}
+		sep, err := evalString(ctx, "join", args[1])
+		if err != nil {
+			return nil, err
+		}
+
+		if err := ctx.charge(len(arr)); err != nil {
+			return nil, err
+		}
+
+		parts := make([]string, len(arr))
+		for i, item := range arr {
+			str, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("join function requires an array of strings, got %T", item)
+			}
+			parts[i] = str
+		}
+		return strings.Join(parts, sep), nil
+	},
+
+	// replace(s, old, new) replaces every occurrence of old
+	"replace": func(ctx *EvalContext, args []Expr) (interface{}, error) {
+		if len(args) != 3 {
+			return nil, fmt.Errorf("replace function requires exactly 3 arguments")
+		}
+		strs, err := evalStrings(ctx, "replace", args)
+		if err != nil {
+			return nil, err
+		}
+		return strings.ReplaceAll(strs[0], strs[1], strs[2]), nil
+	},
+
+	// padLeft(s, width, pad) pads s to width runes, pad defaults to a space
+	"padLeft": func(ctx *EvalContext, args []Expr) (interface{}, error) {
+		if len(args) != 2 && len(args) != 3 {
+			return nil, fmt.Errorf("padLeft function requires 2 or 3 arguments")
+		}
+		str, err := evalString(ctx, "padLeft", args[0])
+		if err != nil {
+			return nil, err
+		}
+		width, err := evalInt(ctx, "padLeft", args[1])
+		if err != nil {
+			return nil, err
+		}
+
+		pad := " "
+		if len(args) == 3 {
+			if pad, err = evalString(ctx, "padLeft", args[2]); err != nil {
+				return nil, err
+			}
+			if pad == "" {
+				return nil, fmt.Errorf("padLeft function requires a non-empty pad")
+			}
+		}
+
+		missing := width - utf8.RuneCountInString(str)
+		if missing <= 0 {
+			return str, nil
+		}
+
+		// the padding is checked before it is built, every rune is a step
+		if err := ctx.checkSize(len(str) + missing); err != nil {
+			return nil, err
+		}
+		if err := ctx.charge(missing); err != nil {
+			return nil, err
+		}
+
+		padRunes := []rune(pad)
+		var sb strings.Builder
+		for i := 0; i < missing; i++ {
+			sb.WriteRune(padRunes[i%len(padRunes)])
+		}
+		sb.WriteString(str)
+
+		return sb.String(), nil
+	},
+}
@@ -0,0 +1,252 @@
+package yap
+
+import (
+	"math/big"
+	"testing"
+)
+
+const functionsJson = `{
+	"threshold": 10,
+	"items": [
+		{"name": "c", "v": 12, "kind": "x"},
+		{"name": "a", "v": 4, "kind": "y"},
+		{"name": "b", "v": 20, "kind": "x"}
+	]
+}`
+
+type evaluateTest struct {
+	expression string
+	expect     string
+}
+
+func runEvaluateTests(t *testing.T, data string, tests []evaluateTest, opts ...EvalOption) {
+	t.Helper()
+
+	for _, test := range tests {
+		result, err := Evaluate(test.expression, data, opts...)
+
+		if err != nil {
+			t.Errorf("%s: failed to evaluate: %v", test.expression, err)
+			continue
+		}
+
+		if result != test.expect {
+			t.Errorf("%s: expected %s, got %s", test.expression, test.expect, result)
+		}
+	}
+}
+
+func TestLambdaFunctions(t *testing.T) {
+	runEvaluateTests(t, functionsJson, []evaluateTest{
+		{`map($.items, @.name)`, `["c","a","b"]`},
+		{`map($.items, { "n": @.name, "big": @.v > $.threshold })`, `[{"big":true,"n":"c"},{"big":false,"n":"a"},{"big":true,"n":"b"}]`},
+		{`filter($.items, @.v > $.threshold)`, `[{"kind":"x","name":"c","v":12},{"kind":"x","name":"b","v":20}]`},
+		{`any($.items, @.v < $.threshold)`, `true`},
+		{`all($.items, @.v < $.threshold)`, `false`},
+		{`reduce($.items, "", @.name)`, `"b"`},
+		{`map(sortBy($.items, @.name), @.name)`, `["a","b","c"]`},
+		{`map(sortBy($.items, @.v), @.v)`, `[4,12,20]`},
+		{`groupBy(map($.items, @.kind), @)`, `{"x":["x","x"],"y":["y"]}`},
+	})
+}
+
+func TestScopes(t *testing.T) {
+	data := `{
+		"threshold": 10,
+		"items": [{"v": 5}, {"v": 15}],
+		"groups": [
+			{"name": "g1", "min": 2, "members": [{"age": 1}, {"age": 3}]},
+			{"name": "g2", "min": 5, "members": [{"age": 1}, {"age": 3}]}
+		]
+	}`
+
+	runEvaluateTests(t, data, []evaluateTest{
+		{`where($.items, @.v > $.threshold)`, `[{"v":15}]`},
+		{`map(where($.groups, g => length(where(g.members, @.age > g.min)) > 0), @.name)`, `["g1"]`},
+		{`map($.groups, g => map(g.members, m => { "group": g.name, "age": m.age }))`, `[[{"age":1,"group":"g1"},{"age":3,"group":"g1"}],[{"age":1,"group":"g2"},{"age":3,"group":"g2"}]]`},
+	})
+}
+
+func TestStringFunctions(t *testing.T) {
+	data := `{"title": "  Project Hail Mary 🌌  ", "name": "Ünïcödé", "csv": "a,b,c"}`
+
+	runEvaluateTests(t, data, []evaluateTest{
+		{`length("🌌🌌")`, `2`},
+		{`lower($.name)`, `"ünïcödé"`},
+		{`upper($.name)`, `"ÜNÏCÖDÉ"`},
+		{`equalsFold($.name, "ÜNÏCÖDÉ")`, `true`},
+		{`equalsFold("Straße", "STRASSE")`, `true`},
+		{"equalsFold(\"e\u0301\", \"É\")", `true`},
+		{`equalsFold("a", "b")`, `false`},
+		{`lower($.name) == lower("ÜNÏCÖDÉ")`, `true`},
+		{`trim($.title)`, `"Project Hail Mary 🌌"`},
+		{`trim("xxhixx", "x")`, `"hi"`},
+		{`contains(lower($.title), "hail")`, `true`},
+		{`startsWith($.name, "Ün")`, `true`},
+		{`endsWith(trim($.title), "🌌")`, `true`},
+		{`substring($.name, 2, 3)`, `"ïcö"`},
+		{`substring($.name, 5)`, `"dé"`},
+		{`substring("abc", 1, 9223372036854775807)`, `"bc"`},
+		{`substring($.name, 6, 9223372036854775807)`, `"é"`},
+		{`split($.csv, ",")`, `["a","b","c"]`},
+		{`join(split($.csv, ","), "-")`, `"a-b-c"`},
+		{`replace($.csv, ",", ";")`, `"a;b;c"`},
+		{`indexOf($.name, "cö")`, `3`},
+		{`indexOf($.name, "x")`, `-1`},
+		{`padLeft("7", 3, "0")`, `"007"`},
+		{`padLeft("🌌", 3)`, `"  🌌"`},
+	})
+}
+
+func TestMathFunctions(t *testing.T) {
+	data := `{"orders": [{"total": 40}, {"total": 70.5}, {"total": 60}], "neg": -2.5}`
+
+	runEvaluateTests(t, data, []evaluateTest{
+		{`sum(map($.orders, @.total))`, `170.5`},
+		{`avg(map($.orders, @.total)) > 50`, `true`},
+		{`min(map($.orders, @.total))`, `40`},
+		{`max(3, 9, 4)`, `9`},
+		{`max("a", "c", "b")`, `"c"`},
+		{`count($.orders)`, `3`},
+		{`count($.orders, @.total > 50)`, `2`},
+		{`abs($.neg)`, `2.5`},
+		{`floor($.neg)`, `-3`},
+		{`ceil($.neg)`, `-2`},
+		{`round(3.14159, 2)`, `3.14`},
+		{`round(2.5)`, `2`},
+		{`round(1234, -2)`, `1200`},
+		{`pow(2, 10)`, `1024`},
+		{`pow(2, -1)`, `0.5`},
+		{`sqrt(16)`, `4`},
+		{`1,000 * 60 + 5 - 10 / 4`, `60002.5`},
+		{`max(100, 200)`, `200`},
+		{`sum([100, 200, 300])`, `600`},
+		{`[1_000,2]`, `[1000,2]`},
+		{`max(1_000, 2)`, `1000`},
+		{`(1,000 + 1) * 2`, `2002`},
+		{`if(2 > 1, 1_000, 2)`, `1000`},
+		{`(60 > 1,000 || 2,000 > 1,999)`, `true`},
+		{`-$.neg * 2`, `5`},
+		{`!($.neg > 0)`, `true`},
+		{`"a" + "b"`, `"ab"`},
+	})
+
+	result, err := Evaluate(`round(2.5)`, data, WithRounding(big.ToNearestAway))
+	if err != nil || result != `3` {
+		t.Errorf("expected 3 when rounding half away from zero, got %v %v", result, err)
+	}
+
+	result, err = Evaluate(`1 / 3`, data, WithPrecision(8))
+	if err != nil || result != `0.334` {
+		t.Errorf("expected 8 bit precision division, got %v %v", result, err)
+	}
+
+	failures := []string{
+		`round(1.5, 50000000)`,
+		`round(1.5, -401)`,
+		`pow(10, 1000000000000)`,
+		`pow(-10, 1000000000001)`,
+		`pow(pow(10, 400), 0.5)`,
+	}
+
+	for _, expression := range failures {
+		if _, err := Evaluate(expression, data); err == nil {
+			t.Errorf("%s: expected an error", expression)
+		}
+	}
+
+	if result, err := Evaluate(`round(1.5, 400) == 1.5 && round(1234, -400) == 0`, data); err != nil || result != `true` {
+		t.Errorf("expected the largest number of digits to round, got %v %v", result, err)
+	}
+}
+
+func TestTypeFunctions(t *testing.T) {
+	data := `{"s": "42.5", "n": 7, "b": true, "a": [1], "o": {"k": "v"}, "z": null, "payload": "{\"x\": [1, 2]}"}`
+
+	runEvaluateTests(t, data, []evaluateTest{
+		{`map([$.s, $.n, $.b, $.a, $.o, $.z, 1h], type(@))`, `["string","number","boolean","array","object","null","duration"]`},
+		{`isString($.s) && isNumber($.n) && isArray($.a) && isObject($.o) && isNull($.z)`, `true`},
+		{`isNumber($.s)`, `false`},
+		{`toNumber($.s) > 40`, `true`},
+		{`toNumber($.b)`, `1`},
+		{`toString($.n) + "!"`, `"7!"`},
+		{`toString($.o)`, `"{\"k\":\"v\"}"`},
+		{`toBool("false")`, `false`},
+		{`toBool($.n)`, `true`},
+		{`toJSON($.a)`, `"[1]"`},
+		{`fromJSON($.payload)`, `{"x":[1,2]}`},
+	})
+
+	failures := []string{
+		`toNumber("abc")`,
+		`toNumber("Inf")`,
+		`toNumber(" -inf ")`,
+		`toNumber("NaN")`,
+		`toNumber($.o)`,
+		`toBool("yes please")`,
+		`fromJSON("{")`,
+		`fromJSON($.n)`,
+	}
+
+	for _, expression := range failures {
+		if _, err := Evaluate(expression, data); err == nil {
+			t.Errorf("%s: expected conversion error", expression)
+		}
+	}
+}
+
+func TestObjectFunctions(t *testing.T) {
+	data := `{"labels": {"team": "core", "env": "prod", "app": "yap"}, "user": {"name": "bob", "password": "hunter2"}}`
+
+	runEvaluateTests(t, data, []evaluateTest{
+		{`keys($.labels)`, `["app","env","team"]`},
+		{`values($.labels)`, `["yap","prod","core"]`},
+		{`entries($.user)`, `[["name","bob"],["password","hunter2"]]`},
+		{`fromEntries(entries($.labels))`, `{"app":"yap","env":"prod","team":"core"}`},
+		{`fromEntries([["a", 1], ["b", 2], ["a", 3]])`, `{"a":3,"b":2}`},
+		{`merge($.user, { "password": null, "role": "admin" })`, `{"name":"bob","password":null,"role":"admin"}`},
+		{`pick($.labels, "team", "env")`, `{"env":"prod","team":"core"}`},
+		{`pick($.labels, ["app"])`, `{"app":"yap"}`},
+		{`omit($.user, "password")`, `{"name":"bob"}`},
+		{`any(keys($.labels), @ == "env")`, `true`},
+	})
+}
+
+func TestArrayFunctions(t *testing.T) {
+	data := `{
+		"mixed": ["b", 2, null, true, "a", 1, [1], {"k": 1}, false],
+		"tags": ["x", "y", "x", "z", "y"],
+		"objects": [{"id": 1}, {"id": 2}, {"id": 1}],
+		"nested": [1, [2, [3, [4]]]]
+	}`
+
+	runEvaluateTests(t, data, []evaluateTest{
+		{`sort($.mixed)`, `[null,false,true,1,2,"a","b",[1],{"k":1}]`},
+		{`sort([3, 1.5, 2])`, `[1.5,2,3]`},
+		{`unique($.tags)`, `["x","y","z"]`},
+		{`unique($.objects)`, `[{"id":1},{"id":2}]`},
+		{`flatten($.nested)`, `[1,2,[3,[4]]]`},
+		{`flatten($.nested, -1)`, `[1,2,3,4]`},
+		{`reverse($.tags)`, `["y","z","x","y","x"]`},
+		{`reverse("ab🌌")`, `"🌌ba"`},
+		{`slice($.tags, 1, 3)`, `["y","x"]`},
+		{`slice($.tags, -2)`, `["z","y"]`},
+		{`slice("héllo", 1, -1)`, `"éll"`},
+		{`first($.tags)`, `"x"`},
+		{`last($.tags)`, `"y"`},
+		{`first([])`, `null`},
+		{`contains($.objects, {"id": 2})`, `true`},
+		{`contains($.mixed, 1)`, `true`},
+		{`contains("haystack", "st")`, `true`},
+		{`in("z", $.tags)`, `true`},
+		{`indexOf($.objects, {"id": 2})`, `1`},
+		{`indexOf($.tags, "q")`, `-1`},
+		{`indexOf("héllo", "l")`, `2`},
+		{`union($.tags, ["w", "x"])`, `["x","y","z","w"]`},
+		{`intersect($.tags, ["z", "x", "q"])`, `["x","z"]`},
+		{`difference($.objects, [{"id": 1}])`, `[{"id":2}]`},
+		{`unique([1, 1.0, toNumber("1"), -0, 0, "1", null, null, true])`, `[1,-0,"1",null,true]`},
+		{`unique([[1, {"a": 1}], [1.0, {"a": 1}], [1, {"a": "1"}]])`, `[[1,{"a":1}],[1,{"a":"1"}]]`},
+		{`intersect([1, 2.5, "a", [1]], [2.50, [1.0]], [[1], 2.5])`, `[2.5,[1]]`},
+	})
+}
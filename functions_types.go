@@ -0,0 +1,204 @@
+package yap
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	registerPureFunctions(typeFunctions)
+}
+
+// typeName is the name of the type of an evaluated value as seen by rules
+func typeName(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case undefined:
+		return "undefined"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	case time.Time:
+		return "time"
+	case time.Duration:
+		return "duration"
+	}
+
+	if isNumber(v) {
+		return "number"
+	}
+
+	return fmt.Sprintf("%T", v)
+}
+
+// convertNumber converts a number, a numeric string or a boolean
+func convertNumber(v any) (*big.Float, error) {
+	if num, ok := toBigFloat(v); ok {
+		return num, nil
+	}
+
+	switch x := v.(type) {
+	case string:
+		num, ok := new(big.Float).SetString(strings.TrimSpace(x))
+		if !ok {
+			return nil, fmt.Errorf("cannot convert string %q to a number", x)
+		}
+		// like a numeric literal the string cannot be infinite, NaN is
+		// already rejected by SetString
+		if num.IsInf() {
+			return nil, fmt.Errorf("cannot convert string %q to a finite number", x)
+		}
+		return num, nil
+	case bool:
+		if x {
+			return NewFloatFromInt(1), nil
+		}
+		return NewFloatFromInt(0), nil
+	}
+
+	return nil, fmt.Errorf("cannot convert %s to a number", typeName(v))
+}
+
+// convertString renders any value as a string, arrays and objects as JSON
+func convertString(v any) (string, error) {
+	switch x := v.(type) {
+	case string:
+		return x, nil
+	case nil:
+		return "null", nil
+	case bool:
+		return strconv.FormatBool(x), nil
+	case time.Time:
+		return x.Format(time.RFC3339Nano), nil
+	case time.Duration:
+		return x.String(), nil
+	case undefined:
+		return "", fmt.Errorf("cannot convert undefined to a string")
+	}
+
+	if num, ok := toBigFloat(v); ok {
+		return num.Text('g', -1), nil
+	}
+
+	encoded, err := json.Marshal(toJSONValue(v))
+	if err != nil {
+		return "", fmt.Errorf("cannot convert %s to a string: %w", typeName(v), err)
+	}
+	return string(encoded), nil
+}
+
+// convertBool converts booleans, the strings accepted by strconv.ParseBool
+// and numbers, where only zero is false
+func convertBool(v any) (bool, error) {
+	switch x := v.(type) {
+	case bool:
+		return x, nil
+	case string:
+		b, err := strconv.ParseBool(x)
+		if err != nil {
+			return false, fmt.Errorf("cannot convert string %q to a boolean", x)
+		}
+		return b, nil
+	}
+
+	if num, ok := toBigFloat(v); ok {
+		return num.Sign() != 0, nil
+	}
+
+	return false, fmt.Errorf("cannot convert %s to a boolean", typeName(v))
+}
+
+// typeCheck builds an isX function comparing the argument type with name
+func typeCheck(function, name string) Function {
+	return func(ctx *EvalContext, args []Expr) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("%s function requires exactly 1 argument", function)
+		}
+		value, err := args[0].Eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return typeName(value) == name, nil
+	}
+}
+
+// conversion builds a toX function from a conversion routine
+func conversion[T any](function string, convert func(any) (T, error)) Function {
+	return func(ctx *EvalContext, args []Expr) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("%s function requires exactly 1 argument", function)
+		}
+		value, err := args[0].Eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		result, err := convert(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s function: %w", function, err)
+		}
+		return result, nil
+	}
+}
+
+var typeFunctions = map[string]Function{
+	// type(x) is one of null, string, number, boolean, array, object,
+	// time, duration or undefined
+	"type": func(ctx *EvalContext, args []Expr) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("type function requires exactly 1 argument")
+		}
+		value, err := args[0].Eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return typeName(value), nil
+	},
+
+	"isString": typeCheck("isString", "string"),
+	"isNumber": typeCheck("isNumber", "number"),
+	"isArray":  typeCheck("isArray", "array"),
+	"isObject": typeCheck("isObject", "object"),
+	"isNull":   typeCheck("isNull", "null"),
+
+	"toNumber": conversion("toNumber", convertNumber),
+	"toString": conversion("toString", convertString),
+	"toBool":   conversion("toBool", convertBool),
+
+	// toJSON(x) encodes any value as a JSON string
+	"toJSON": conversion("toJSON", func(v any) (string, error) {
+		if v == Undefined {
+			return "", fmt.Errorf("cannot encode undefined")
+		}
+
+		encoded, err := json.Marshal(toJSONValue(v))
+		if err != nil {
+			return "", err
+		}
+		return string(encoded), nil
+	}),
+
+	// fromJSON(str) decodes a JSON string into a value
+	"fromJSON": conversion("fromJSON", func(v any) (any, error) {
+		str, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("cannot decode %s, expected a string", typeName(v))
+		}
+
+		var decoded any
+		if err := json.Unmarshal([]byte(str), &decoded); err != nil {
+			return nil, fmt.Errorf("invalid JSON: %w", err)
+		}
+		return decoded, nil
+	}),
+}
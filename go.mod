@@ -1,3 +1,5 @@
 module github.com/rbrick/yap
 
-go 1.25.1
+go 1.26.0
+
+require golang.org/x/text v0.42.0
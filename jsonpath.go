@@ -11,16 +11,26 @@ var IndexedPattern = regexp.MustCompile(`\[([0-9]+)\]`)
 
 type Resolver func(data any) (any, error)
 
+// MissingError is returned by resolvers when the data does not contain
+// the requested key or index, or when the data to resolve against is null
+type MissingError struct {
+	Reason string
+}
+
+func (e *MissingError) Error() string {
+	return e.Reason
+}
+
 func ArrayIndexResolver(index int) Resolver {
 	return func(data any) (any, error) {
 		if data == nil {
-			return nil, fmt.Errorf("null data")
+			return nil, &MissingError{Reason: "null data"}
 		}
 
 		switch v := data.(type) {
 		case []any:
 			if index < 0 || index >= len(v) {
-				return nil, fmt.Errorf("index %d out of bounds", index)
+				return nil, &MissingError{Reason: fmt.Sprintf("index %d out of bounds", index)}
 			}
 			return v[index], nil
 		default:
@@ -32,14 +42,14 @@ func ArrayIndexResolver(index int) Resolver {
 func KeyResolver(key string) Resolver {
 	return func(data any) (any, error) {
 		if data == nil {
-			return nil, fmt.Errorf("null data")
+			return nil, &MissingError{Reason: "null data"}
 		}
 
 		switch v := data.(type) {
 		case map[string]any:
 			val, exists := v[key]
 			if !exists {
-				return nil, fmt.Errorf("key %s does not exist", key)
+				return nil, &MissingError{Reason: fmt.Sprintf("key %s does not exist", key)}
 			}
 			return val, nil
 		default:
@@ -79,6 +89,28 @@ func (p *Path) Resolve(data any) (any, error) {
 	return current, nil
 }
 
+// resolveBound resolves the path against the value bound to the key of its
+// first segment, e.g. the current item for @.tags[0]
+func (p *Path) resolveBound(value any) (any, error) {
+	var err error
+
+	for i, segment := range p.Segments {
+		resolvers := segment.Resolvers
+		if i == 0 {
+			resolvers = resolvers[1:]
+		}
+
+		for _, resolver := range resolvers {
+			value, err = resolver(value)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return value, nil
+}
+
 type Segment struct {
 	Name      string
 	Resolvers []Resolver
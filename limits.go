@@ -0,0 +1,190 @@
+package yap
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+)
+
+// Limits bound the resources a user authored expression may use. Parsing
+// is bounded by ParseOptions, evaluation by EvalOptions, a limit of 0 is
+// unlimited. Exceeding a limit fails with a *LimitError, an evaluation
+// whose context is done fails with the context's error.
+
+// Limit identifies one of the limits of parsing or evaluation
+type Limit int
+
+const (
+	// LengthLimit bounds the length of an expression in bytes
+	LengthLimit Limit = iota
+	// NestingLimit bounds how deeply parentheses, function arguments,
+	// array elements, object values and lambda bodies are nested
+	NestingLimit
+	// StepLimit bounds the steps of an evaluation, each instruction, each
+	// item a function iterates over and each comparison or item a builtin
+	// such as sort or unique works through is a step
+	StepLimit
+	// ResultSizeLimit bounds the items of an array or object, or the bytes
+	// of a string, that an operator or function produces
+	ResultSizeLimit
+	// DepthLimit bounds the nesting of scopes, each function evaluating an
+	// expression per item, e.g. where or map, opens a scope
+	DepthLimit
+)
+
+func (l Limit) String() string {
+	switch l {
+	case LengthLimit:
+		return "expression length"
+	case NestingLimit:
+		return "expression nesting"
+	case StepLimit:
+		return "evaluation steps"
+	case ResultSizeLimit:
+		return "result size"
+	case DepthLimit:
+		return "scope depth"
+	default:
+		return fmt.Sprintf("Limit(%d)", int(l))
+	}
+}
+
+// LimitError is returned when an expression exceeds one of its limits
+type LimitError struct {
+	Limit Limit
+	Max   int
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s limit of %d exceeded", e.Limit, e.Max)
+}
+
+// ParseOption configures the parsing of an expression
+type ParseOption func(limits *parseLimits)
+
+type parseLimits struct {
+	maxLength  int
+	maxNesting int
+}
+
+func newParseLimits(opts []ParseOption) parseLimits {
+	var limits parseLimits
+	for _, opt := range opts {
+		opt(&limits)
+	}
+	return limits
+}
+
+// WithMaxLength limits the length of an expression in bytes
+func WithMaxLength(length int) ParseOption {
+	return func(limits *parseLimits) {
+		limits.maxLength = length
+	}
+}
+
+// WithMaxNesting limits how deeply an expression nests parentheses,
+// function arguments, array elements, object values and lambda bodies
+func WithMaxNesting(depth int) ParseOption {
+	return func(limits *parseLimits) {
+		limits.maxNesting = depth
+	}
+}
+
+// cancelCheckInterval is the number of steps between checks of whether
+// the context of an evaluation is done
+const cancelCheckInterval = 256
+
+// WithContext stops the evaluation with the context's error once it is
+// done, e.g. when its deadline passes
+func WithContext(c context.Context) EvalOption {
+	return func(ctx *EvalContext) {
+		ctx.Context = c
+	}
+}
+
+// WithMaxSteps limits the number of steps of an evaluation, each rule of a
+// RuleSet has its own steps
+func WithMaxSteps(steps int) EvalOption {
+	return func(ctx *EvalContext) {
+		ctx.MaxSteps = steps
+	}
+}
+
+// WithMaxResultSize limits the items of an array or object, or the bytes
+// of a string, that an operator or function produces
+func WithMaxResultSize(size int) EvalOption {
+	return func(ctx *EvalContext) {
+		ctx.MaxResultSize = size
+	}
+}
+
+// WithMaxDepth limits the nesting of scopes opened by functions such as
+// where and map
+func WithMaxDepth(depth int) EvalOption {
+	return func(ctx *EvalContext) {
+		ctx.MaxDepth = depth
+	}
+}
+
+// step counts a step of the evaluation, it fails when the steps exceed
+// MaxSteps or the context is done
+func (ctx *EvalContext) step() error {
+	return ctx.charge(1)
+}
+
+// charge counts n steps of the evaluation at once, e.g. the items a
+// builtin is about to work through
+func (ctx *EvalContext) charge(n int) error {
+	if ctx.steps == nil || n <= 0 {
+		return nil
+	}
+
+	total := ctx.steps.Add(int64(n))
+
+	if ctx.MaxSteps > 0 && total > int64(ctx.MaxSteps) {
+		return &LimitError{Limit: StepLimit, Max: ctx.MaxSteps}
+	}
+
+	// the context is checked on the first step and then whenever the
+	// steps pass another cancelCheckInterval
+	if before := total - int64(n); ctx.Context != nil && (before == 0 || before/cancelCheckInterval != total/cancelCheckInterval) {
+		return ctx.Context.Err()
+	}
+
+	return nil
+}
+
+// countSteps starts counting the steps of the evaluation when they are
+// limited or it can be canceled
+func (ctx *EvalContext) countSteps() {
+	if ctx.MaxSteps > 0 || ctx.Context != nil {
+		ctx.steps = new(atomic.Int64)
+	}
+}
+
+// checkSize fails when size exceeds MaxResultSize
+func (ctx *EvalContext) checkSize(size int) error {
+	if ctx.MaxResultSize > 0 && size > ctx.MaxResultSize {
+		return &LimitError{Limit: ResultSizeLimit, Max: ctx.MaxResultSize}
+	}
+	return nil
+}
+
+// checkResult fails when value is an array, object or string larger than
+// MaxResultSize
+func (ctx *EvalContext) checkResult(value any) error {
+	if ctx.MaxResultSize == 0 {
+		return nil
+	}
+
+	switch v := value.(type) {
+	case []any:
+		return ctx.checkSize(len(v))
+	case map[string]any:
+		return ctx.checkSize(len(v))
+	case string:
+		return ctx.checkSize(len(v))
+	}
+
+	return nil
+}
@@ -0,0 +1,202 @@
+package yap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/text/language"
+)
+
+func TestParseLimits(t *testing.T) {
+	tests := []struct {
+		expression string
+		opts       []ParseOption
+		limit      Limit
+	}{
+		{`$.name == "Ada"`, []ParseOption{WithMaxLength(10)}, LengthLimit},
+		{`length(length(length("a")))`, []ParseOption{WithMaxNesting(3)}, NestingLimit},
+		{`((((1))))`, []ParseOption{WithMaxNesting(4)}, NestingLimit},
+		{`map($.a, x => [{ "v": x }])`, []ParseOption{WithMaxNesting(4)}, NestingLimit},
+		{strings.Repeat("(", 100000) + "1" + strings.Repeat(")", 100000), []ParseOption{WithMaxNesting(64)}, NestingLimit},
+		{strings.Repeat("!", 100000) + "true", []ParseOption{WithMaxNesting(100)}, NestingLimit},
+		{strings.Repeat("-", 101) + "1", []ParseOption{WithMaxNesting(100)}, NestingLimit},
+	}
+
+	for _, test := range tests {
+		_, err := NewEvaluator(test.expression, test.opts...)
+
+		var limitErr *LimitError
+		if !errors.As(err, &limitErr) || limitErr.Limit != test.limit {
+			t.Errorf("%.40s: expected the %s limit to be exceeded, got %v", test.expression, test.limit, err)
+		}
+	}
+
+	for _, expression := range []string{`length(length(length("a")))`, `((1))`, `1 + 2 + 3 + 4 + 5 + 6`, `$.a ? 1 : $.b ? 2 : $.c ? 3 : 4`, `!!!true`, `-(-1)`} {
+		if _, err := NewEvaluator(expression, WithMaxNesting(4), WithMaxLength(len(expression))); err != nil {
+			t.Errorf("%s: %v", expression, err)
+		}
+	}
+
+	rules := NewRuleSet(WithMaxLength(8))
+	if err := rules.Add("long", `$.name == "Ada"`); !errors.As(err, new(*LimitError)) {
+		t.Errorf("expected the rule set to limit the length, got %v", err)
+	}
+}
+
+func TestEvaluationLimits(t *testing.T) {
+	data := largeArray(1000, func(i int) string { return fmt.Sprintf(`{"v": %d}`, i) })
+
+	tests := []struct {
+		expression string
+		opts       []EvalOption
+		limit      Limit
+	}{
+		{`map($.items, @.v * 2)`, []EvalOption{WithMaxSteps(100)}, StepLimit},
+		{`map($.items, @)`, []EvalOption{WithMaxSteps(500)}, StepLimit},
+		{`map($.items, @.v * 2)`, []EvalOption{WithMaxSteps(100), WithParallelism(4)}, StepLimit},
+		{`count($.items, x => any($.items, @.v > x.v))`, []EvalOption{WithMaxSteps(100000)}, StepLimit},
+		{`map($.items, @.v)`, []EvalOption{WithMaxResultSize(999)}, ResultSizeLimit},
+		{`map($.items, @.v) ?? []`, []EvalOption{WithMaxResultSize(999)}, ResultSizeLimit},
+		{`padLeft("a", 1000000000)`, []EvalOption{WithMaxResultSize(1000)}, ResultSizeLimit},
+		{`reduce($.items, "ab", @acc + @acc)`, []EvalOption{WithMaxResultSize(1 << 20)}, ResultSizeLimit},
+		{`map($.items, x => map([1], y => map([2], @)))`, []EvalOption{WithMaxDepth(2)}, DepthLimit},
+	}
+
+	for _, test := range tests {
+		evaluator, err := NewEvaluator(test.expression)
+		if err != nil {
+			t.Fatalf("%s: %v", test.expression, err)
+		}
+
+		_, err = evaluator.Eval(data, test.opts...)
+
+		var limitErr *LimitError
+		if !errors.As(err, &limitErr) || limitErr.Limit != test.limit {
+			t.Errorf("%s: expected the %s limit to be exceeded, got %v", test.expression, test.limit, err)
+		}
+	}
+
+	for _, expression := range []string{`map($.items, @.v * 2)`, `padLeft("a", 1000)`, `map($.items, x => map([1], y => map([2], @)))`} {
+		evaluator, err := NewEvaluator(expression)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := evaluator.Eval(data, WithMaxSteps(10000), WithMaxResultSize(1000), WithMaxDepth(3)); err != nil {
+			t.Errorf("%s: %v", expression, err)
+		}
+	}
+
+	if err := (&LimitError{Limit: StepLimit, Max: 100}).Error(); err != "evaluation steps limit of 100 exceeded" {
+		t.Errorf("unexpected message %q", err)
+	}
+}
+
+func TestEvaluationCancellation(t *testing.T) {
+	data := largeArray(3000, func(i int) string { return fmt.Sprintf(`{"v": %d}`, i) })
+
+	evaluator, err := NewEvaluator(`count($.items, x => count($.items, @.v == x.v) > 1)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := evaluator.Eval(data, WithContext(canceled)); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the evaluation to be canceled, got %v", err)
+	}
+
+	for _, workers := range []int{0, 4} {
+		timeout, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+
+		start := time.Now()
+		_, err = evaluator.Eval(data, WithContext(timeout), WithParallelism(workers))
+		cancel()
+
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected the evaluation to time out, got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("expected the evaluation to stop at its deadline, took %v", elapsed)
+		}
+	}
+
+	result, err := evaluator.Eval(`{"items": [{"v": 1}, {"v": 1}]}`, WithContext(context.Background()))
+	if err != nil || encodeResult(result, err) != "2" {
+		t.Errorf("expected 2, got %v %v", result, err)
+	}
+}
+
+func TestBuiltinLimits(t *testing.T) {
+	numbers := make([]string, 40000)
+	for i := range numbers {
+		numbers[i] = fmt.Sprint(i)
+	}
+	data := fmt.Sprintf(`{"a": [%s], "csv": %q}`, strings.Join(numbers, ", "), strings.Join(numbers, ", "))
+
+	for _, expression := range []string{
+		`unique($.a)`,
+		`union($.a, [1])`,
+		`intersect($.a, $.a)`,
+		`difference($.a, [1])`,
+		`sort($.a)`,
+		`sum($.a)`,
+		`contains($.a, -1)`,
+		`split($.csv, ",")`,
+		`padLeft("a", 100000)`,
+	} {
+		evaluator, err := NewEvaluator(expression)
+		if err != nil {
+			t.Fatalf("%s: %v", expression, err)
+		}
+
+		start := time.Now()
+		_, err = evaluator.Eval(data, WithMaxSteps(1000))
+
+		var limitErr *LimitError
+		if !errors.As(err, &limitErr) || limitErr.Limit != StepLimit {
+			t.Errorf("%s: expected the steps limit to be exceeded, got %v", expression, err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("%s: expected the builtin to stop at the steps limit, took %v", expression, elapsed)
+		}
+	}
+
+	evaluator, err := NewEvaluator(`unique(slice($.a, 0, 10))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result, err := evaluator.Eval(data, WithMaxSteps(1000)); err != nil || encodeResult(result, err) != "[0,1,2,3,4,5,6,7,8,9]" {
+		t.Errorf("expected the first ten numbers, got %v %v", result, err)
+	}
+
+	if evaluator, err = NewEvaluator(`unique($.a)`); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	if result, err := evaluator.Eval(data); err != nil || len(result.([]any)) != len(numbers) {
+		t.Errorf("expected %d unique numbers, got %v", len(numbers), err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected unique to hash the numbers, took %v", elapsed)
+	}
+
+	timeout, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	// with a collation every value is compared
+	start = time.Now()
+	if _, err := evaluator.Eval(data, WithContext(timeout), WithCollation(language.English)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected unique to time out, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected unique to stop at its deadline, took %v", elapsed)
+	}
+}
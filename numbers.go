@@ -0,0 +1,177 @@
+package yap
+
+import (
+	"cmp"
+	"math"
+	"math/big"
+	"strconv"
+)
+
+// Numbers decoded from JSON are float64 values and numbers that are not
+// exact integers are *big.Float values. Exact integers, such as integer
+// literals, lengths and the sum of two integers, are kept as native
+// integers so the common case neither allocates nor converts. The native
+// path is taken only when its result is the value the *big.Float path
+// would produce, everything else falls back to *big.Float.
+
+// maxExactInt bounds native integers, up to it every integer is exact in
+// a float64 and prints the same at any precision
+const maxExactInt = 1 << 53
+
+// int53 is a native integer standing for a 53 bit *big.Float, e.g. the
+// sum of two integers decoded from JSON, while int64 stands for a 64 bit
+// one, e.g. a literal. As a computed *big.Float takes the largest
+// precision of its operands, the precision decides how a later inexact
+// result is rounded.
+type int53 int64
+
+// nativeInt returns the value of a number that is an exact integer within
+// maxExactInt and whether it stands for a 64 bit precision
+func nativeInt(v any) (i int64, wide bool, ok bool) {
+	switch x := v.(type) {
+	case int64:
+		return x, true, abs(x) <= maxExactInt
+	case int53:
+		return int64(x), false, true
+	case float64:
+		if x == math.Trunc(x) && math.Abs(x) <= maxExactInt && !(x == 0 && math.Signbit(x)) {
+			return int64(x), false, true
+		}
+	case *big.Float:
+		if (x.Prec() == 53 || x.Prec() == 64) && x.IsInt() && !(x.Sign() == 0 && x.Signbit()) {
+			i, accuracy := x.Int64()
+			if accuracy == big.Exact && abs(i) <= maxExactInt {
+				return i, x.Prec() == 64, true
+			}
+		}
+	}
+
+	return 0, false, false
+}
+
+// nativeResult is the integer i with the precision of its operands
+func nativeResult(i int64, wide bool) any {
+	if wide {
+		return i
+	}
+	return int53(i)
+}
+
+// isNumber reports whether v is a number of any representation
+func isNumber(v any) bool {
+	switch v.(type) {
+	case float64, int64, int53, *big.Float:
+		return true
+	}
+	return false
+}
+
+// nativeFloat returns the value of a float64 or a native integer
+func nativeFloat(v any) (float64, bool) {
+	switch x := v.(type) {
+	case float64:
+		return x, true
+	case int64:
+		return float64(x), abs(x) <= maxExactInt
+	case int53:
+		return float64(x), true
+	}
+
+	return 0, false
+}
+
+// bigNumber returns a number as a *big.Float, dst holds the converted
+// value unless v already is a *big.Float
+func bigNumber(dst *big.Float, v any) (*big.Float, bool) {
+	switch x := v.(type) {
+	case *big.Float:
+		return x, true
+	case float64:
+		return dst.SetFloat64(x), true
+	case int64:
+		return dst.SetInt64(x), true
+	case int53:
+		return dst.SetPrec(53).SetInt64(int64(x)), true
+	}
+
+	return nil, false
+}
+
+// compareNumbers orders two numbers of any representation, returning -1,
+// 0 or 1, ok is false when either value is not a number
+func compareNumbers(left, right any) (int, bool) {
+	lFloat, lNative := nativeFloat(left)
+	rFloat, rNative := nativeFloat(right)
+
+	if lNative && rNative {
+		return cmp.Compare(lFloat, rFloat), true
+	}
+
+	var lBuffer, rBuffer big.Float
+
+	lNum, ok := bigNumber(&lBuffer, left)
+	if !ok {
+		return 0, false
+	}
+	rNum, ok := bigNumber(&rBuffer, right)
+	if !ok {
+		return 0, false
+	}
+
+	return lNum.Cmp(rNum), true
+}
+
+// nativeArithmetic computes +, -, * and / of two exact integers when the
+// result is an exact integer too, ok is false when *big.Float arithmetic
+// is needed. A zero result that *big.Float would give a negative sign,
+// e.g. 0 * -1, is left to it as well.
+func nativeArithmetic(ctx *EvalContext, operator string, left, right any) (any, bool) {
+	if ctx.Precision != 0 {
+		return nil, false
+	}
+
+	l, lWide, ok := nativeInt(left)
+	if !ok {
+		return nil, false
+	}
+	r, rWide, ok := nativeInt(right)
+	if !ok {
+		return nil, false
+	}
+
+	var result int64
+
+	switch operator {
+	case "+":
+		result = l + r
+	case "-":
+		result = l - r
+	case "*":
+		if l != 0 && abs(r) > maxExactInt/abs(l) {
+			return nil, false
+		}
+		if result = l * r; result == 0 && (l < 0 || r < 0) {
+			return nil, false
+		}
+	case "/":
+		if r == 0 || l%r != 0 {
+			return nil, false
+		}
+		if result = l / r; result == 0 && r < 0 {
+			return nil, false
+		}
+	default:
+		return nil, false
+	}
+
+	if abs(result) > maxExactInt {
+		return nil, false
+	}
+
+	return nativeResult(result, lWide || rWide), true
+}
+
+// formatInt formats a native integer like the *big.Float of the same value
+func formatInt(i int64) string {
+	return strconv.FormatFloat(float64(i), 'g', -1, 64)
+}
@@ -0,0 +1,108 @@
+package yap
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// The native number path has to give exactly the results of *big.Float
+// arithmetic, including the precision inherited by later results and the
+// sign of zero.
+func TestNativeNumbers(t *testing.T) {
+	data := `{"x": 0.1, "y": 0.2, "big": 1234567, "i": 7, "j": -3, "z": 0, "huge": 9007199254740993, "f": 2.5, "n": 123456}`
+
+	runEvaluateTests(t, data, []evaluateTest{
+		{`$.x + 1`, `1.1000000000000000056`},
+		{`$.x + $.y`, `0.30000000000000004`},
+		{`1234567 + 0`, `1.234567e+06`},
+		{`$.big + 0`, `1.234567e+06`},
+		{`0.1 + 0.2`, `0.3`},
+		{`$.i * 3`, `21`},
+		{`$.i / 3`, `2.3333333333333333333`},
+		{`2 / 3`, `0.6666666666666666667`},
+		{`$.i + $.j`, `4`},
+		{`($.i + $.j) + 0.1`, `4.1`},
+		{`($.i + $.j) + $.x`, `4.1`},
+		{`($.i + 1) + $.x`, `8.1000000000000000056`},
+		{`($.i * $.j) / 7`, `-3`},
+		{`$.i / 7 + $.x`, `1.1000000000000000056`},
+		{`0 * -1`, `-0`},
+		{`$.z * $.j`, `-0`},
+		{`-0`, `-0`},
+		{`-$.z`, `-0`},
+		{`-$.i`, `-7`},
+		{`-(1 - 1)`, `-0`},
+		{`$.z / $.j`, `-0`},
+		{`0 / -5`, `-0`},
+		{`$.z - 0`, `0`},
+		{`9007199254740992 + 1`, `9.007199254740993e+15`},
+		{`9007199254740992 * 2`, `1.8014398509481984e+16`},
+		{`$.huge + 1`, `9.007199254740993e+15`},
+		{`$.huge`, `9007199254740992`},
+		{`4503599627370496 * 2 + 1`, `9.007199254740993e+15`},
+		{`100000000000000000000 * 10`, `1e+21`},
+		{`1000000`, `1e+06`},
+		{`123456`, `123456`},
+		{`$.n * 10`, `1.23456e+06`},
+		{`$.n + 1`, `123457`},
+		{`$.f * 2`, `5`},
+		{`$.f * 2 + $.x`, `5.1000000000000000056`},
+		{`$.i - 7`, `0`},
+		{`length("abc") / 2`, `1.5`},
+		{`length("abcd") / 2 + $.x`, `2.1000000000000000056`},
+		{`count([1,2,3]) * 1.5`, `4.5`},
+		{`sum([1, 2, 3])`, `6`},
+		{`sum([$.i, $.j]) + $.x`, `4.1`},
+		{`avg([1, 2])`, `1.5`},
+		{`round($.f)`, `2`},
+		{`round($.f) + $.x`, `2.10000000000000000555111512312578270212`},
+		{`round(2.5) / 2`, `1`},
+		{`abs($.j) + $.x`, `3.1`},
+		{`toString(1234567)`, `"1.234567e+06"`},
+		{`toString($.i + $.j)`, `"4"`},
+		{`toString(length("ab"))`, `"2"`},
+		{`type($.i + 1)`, `"number"`},
+		{`$.i + 1 == 8`, `true`},
+		{`$.i + 1 > 7.5`, `true`},
+		{`[1, 2] == [1.0, 2]`, `true`},
+		{`indexOf([1, 2, 3], 2.0) + 0.5`, `1.5`},
+		{`toJSON({ "a": $.i + 1, "b": 1234567 })`, `"{\"a\":8,\"b\":1.234567e+06}"`},
+		{`keys(groupBy([1, 2, 1.5], @ * 2))`, `["2","3","4"]`},
+		{`max(1, $.i, 2.5)`, `7`},
+		{`sort([3, $.i, 1.5, -2])`, `[-2,1.5,3,7]`},
+		{`$.i * 1000000 * 1000000 * 1000`, `7e+15`},
+		{`pow(2, 60) + 1`, `1.152921504606846977e+18`},
+		{`floor($.f) * $.x`, `0.2`},
+		{`-(-9007199254740992)`, `9.007199254740992e+15`},
+		{`-9007199254740992 - 1`, `-9.007199254740993e+15`},
+		{`$.i + 1 ?? 5`, `8`},
+		{`($.i > 3 ? $.i : 0) + 0.25`, `7.25`},
+		{`1 / 3 * 3`, `1`},
+		{`6 / 3 * $.x`, `0.2000000000000000111`},
+		{`(1 - 1) * -1`, `-0`},
+		{`diff(parseTime(1000), parseTime(0), "s") + 1`, `2`},
+	})
+}
+
+func TestNativeComparisonsDoNotAllocate(t *testing.T) {
+	evaluator, err := NewEvaluator(`$.threshold > 5 && $.user.age <= 36 && length($.name) == 3`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var js any
+	if err := json.Unmarshal([]byte(vmJson), &js); err != nil {
+		t.Fatal(err)
+	}
+	ctx := newEvalContext(js, nil)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		if result, err := evaluator.optimized.Eval(ctx); err != nil || result != true {
+			t.Fatalf("expected true, got %v %v", result, err)
+		}
+	})
+
+	if allocs != 0 {
+		t.Errorf("expected no allocations, got %v", allocs)
+	}
+}
@@ -0,0 +1,256 @@
+package yap
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// The optimizer simplifies an expression tree before it is compiled:
+// subexpressions of constants, including calls to PureFunctions, are
+// evaluated once, && and || with a constant left operand lose the branch
+// that can no longer decide the result, conditionals with a constant
+// condition are replaced by the branch taken, and paths and patterns that
+// are known in advance are parsed and compiled.
+//
+// Folded values are computed with the default evaluation settings, an
+// evaluation changing how numbers or strings are computed runs the
+// unoptimized program instead, see foldable.
+
+// constExpr is a folded value without a literal syntax, e.g. a time
+type constExpr struct {
+	Value any
+}
+
+func (c *constExpr) Node() Expr {
+	return c
+}
+
+func (c *constExpr) Eval(ctx *EvalContext) (interface{}, error) {
+	return c.Value, nil
+}
+
+// foldable reports whether an evaluation computes the same values as the
+// optimizer did when folding constants, a limited result size applies to
+// folded values too
+func foldable(ctx *EvalContext) bool {
+	return ctx.Precision == 0 && ctx.Rounding == big.ToNearestEven && ctx.Collation == nil && ctx.MaxResultSize == 0
+}
+
+// maxFoldSteps and maxFoldSize bound the evaluation of a constant
+// subexpression, one exceeding them is left to be evaluated with the
+// limits of an evaluation. Unlike a deadline they fold an expression the
+// same way on every run.
+const (
+	maxFoldSteps = 1 << 16
+	maxFoldSize  = 1 << 16
+)
+
+// constantValue is the value of a constant leaf node
+func constantValue(expr Expr) (any, bool) {
+	switch e := expr.(type) {
+	case *Literal[string]:
+		return e.Value, true
+	case *Literal[*big.Float]:
+		return e.Value, true
+	case *Literal[int64]:
+		return e.Value, true
+	case *Literal[bool]:
+		return e.Value, true
+	case *Literal[time.Duration]:
+		return e.Value, true
+	case *RegexLiteral:
+		return e.Pattern, true
+	case *NullLiteral:
+		return nil, true
+	case *constExpr:
+		return e.Value, true
+	}
+
+	return nil, false
+}
+
+// isConstant reports whether expr evaluates to the same value in any scope
+func isConstant(expr Expr) bool {
+	switch e := expr.(type) {
+	case *ArrayLiteral:
+		return allConstant(e.Elements)
+	case *ObjectLiteral:
+		return allConstant(e.Values)
+	}
+
+	_, ok := constantValue(expr)
+	return ok
+}
+
+func allConstant(exprs []Expr) bool {
+	for _, expr := range exprs {
+		if !isConstant(expr) {
+			return false
+		}
+	}
+	return true
+}
+
+// constantNode is the node of a folded value. Arrays and objects are not
+// folded, the caller of an evaluation may modify them.
+func constantNode(value any) (Expr, bool) {
+	switch v := value.(type) {
+	case string:
+		return &Literal[string]{Value: v}, true
+	case *big.Float:
+		return &Literal[*big.Float]{Value: v}, true
+	case int64:
+		return &Literal[int64]{Value: v}, true
+	case bool:
+		return &Literal[bool]{Value: v}, true
+	case time.Duration:
+		return &Literal[time.Duration]{Value: v}, true
+	case nil:
+		return &NullLiteral{}, true
+	case float64, int53, time.Time:
+		return &constExpr{Value: v}, true
+	}
+
+	return nil, false
+}
+
+// fold evaluates expr when all its operands are constant, an expression
+// failing to evaluate is kept so the error is raised when it is evaluated
+func fold(expr Expr, operands ...Expr) Expr {
+	if !allConstant(operands) {
+		return expr
+	}
+
+	value, err := foldValue(expr)
+	if err != nil {
+		return expr
+	}
+
+	if node, ok := constantNode(value); ok {
+		return node
+	}
+
+	return expr
+}
+
+// foldValue evaluates a constant expr within the fold limits, a panicking
+// function fails the fold rather than the compilation
+func foldValue(expr Expr) (value any, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("folding panicked: %v", r)
+		}
+	}()
+
+	return expr.Eval(newEvalContext(nil, []EvalOption{WithMaxSteps(maxFoldSteps), WithMaxResultSize(maxFoldSize)}))
+}
+
+// isBoolean reports whether expr always evaluates to a boolean
+func isBoolean(expr Expr) bool {
+	switch e := expr.(type) {
+	case *Literal[bool]:
+		return true
+	case *UnaryOp:
+		return e.Operator == "!"
+	case *BinOp:
+		switch e.Operator {
+		case "==", "!=", "<", ">", "<=", ">=", "=~", "!~", "&&", "||":
+			return true
+		}
+	}
+
+	return false
+}
+
+// precompileRegex compiles a pattern that became a literal by folding, an
+// invalid pattern is kept to fail when it is evaluated
+func precompileRegex(name string, expr Expr) Expr {
+	if compiled, err := compileRegex(name, expr); err == nil {
+		return compiled
+	}
+	return expr
+}
+
+// optimize returns a simplified copy of expr, the tree itself is not changed
+func optimize(expr Expr) Expr {
+	switch e := expr.(type) {
+	case *Ident:
+		if path, err := newPathExpr(e); err == nil {
+			return path
+		}
+	case *BinOp:
+		return optimizeBinOp(e)
+	case *UnaryOp:
+		operand := optimize(e.Operand)
+		return fold(&UnaryOp{Operator: e.Operator, Operand: operand}, operand)
+	case *Conditional:
+		condition := optimize(e.Condition)
+
+		if value, ok := constantValue(condition); ok {
+			if toBoolean(value) {
+				return optimize(e.Then)
+			}
+			return optimize(e.Else)
+		}
+
+		return &Conditional{Condition: condition, Then: optimize(e.Then), Else: optimize(e.Else)}
+	case *ArrayLiteral:
+		return &ArrayLiteral{Elements: optimizeAll(e.Elements)}
+	case *ObjectLiteral:
+		return &ObjectLiteral{Keys: e.Keys, Values: optimizeAll(e.Values)}
+	case *Lambda:
+		return &Lambda{Param: e.Param, Body: optimize(e.Body)}
+	case *FuncCall:
+		args := optimizeAll(e.Args)
+
+		if i, ok := regexArgs[e.Name]; ok && i < len(args) {
+			args[i] = precompileRegex(e.Name, args[i])
+		}
+
+		call := &FuncCall{Name: e.Name, Args: args}
+		if PureFunctions[e.Name] {
+			return fold(call, args...)
+		}
+		return call
+	}
+
+	return expr
+}
+
+func optimizeAll(exprs []Expr) []Expr {
+	optimized := make([]Expr, len(exprs))
+	for i, expr := range exprs {
+		optimized[i] = optimize(expr)
+	}
+	return optimized
+}
+
+func optimizeBinOp(b *BinOp) Expr {
+	left, right := optimize(b.Left), optimize(b.Right)
+
+	// a constant left operand decides whether the right one is needed
+	if value, ok := constantValue(left); ok {
+		switch b.Operator {
+		case "&&", "||":
+			truthy := toBoolean(value)
+			if truthy == (b.Operator == "||") {
+				return &Literal[bool]{Value: truthy}
+			}
+			if isBoolean(right) {
+				return right
+			}
+		case "??":
+			if !isAbsent(value) {
+				return left
+			}
+			return right
+		}
+	}
+
+	if b.Operator == "=~" || b.Operator == "!~" {
+		right = precompileRegex(b.Operator, right)
+	}
+
+	return fold(&BinOp{Left: left, Operator: b.Operator, Right: right}, left, right)
+}
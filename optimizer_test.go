@@ -0,0 +1,194 @@
+package yap
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+// optimized parses an expression and returns its optimized tree
+func optimized(t *testing.T, expression string) Expr {
+	t.Helper()
+
+	tokens, err := Tokenize(strings.NewReader(expression))
+	if err != nil {
+		t.Fatalf("%s: %v", expression, err)
+	}
+
+	expr, err := NewParser(tokens).Parse()
+	if err != nil {
+		t.Fatalf("%s: %v", expression, err)
+	}
+
+	return optimize(expr)
+}
+
+func TestOptimizeFoldsConstants(t *testing.T) {
+	constants := map[string]string{
+		`length("abc")`:                     `3`,
+		`1,000 * 60`:                        `60000`,
+		`-5 + 2`:                            `-3`,
+		`upper("a") + lower("B")`:           `"Ab"`,
+		`contains(["a", "b"], "b")`:         `true`,
+		`false && $.missing`:                `false`,
+		`true || $.missing`:                 `true`,
+		`null ?? "fallback"`:                `"fallback"`,
+		`"first" ?? $.missing`:              `"first"`,
+		`true ? "yes" : $.missing`:          `"yes"`,
+		`parseTime("2024-01-02T03:04:05Z")`: `"2024-01-02T03:04:05Z"`,
+		`1h + 30m`:                          `"1h30m0s"`,
+	}
+
+	for expression, expect := range constants {
+		expr := optimized(t, expression)
+
+		value, ok := constantValue(expr)
+		if !ok {
+			t.Errorf("%s: expected a constant, got %T", expression, expr)
+			continue
+		}
+
+		if result := encodeResult(value, nil); result != expect {
+			t.Errorf("%s: expected %s, got %s", expression, expect, result)
+		}
+	}
+}
+
+func TestOptimizeKeepsDynamicExpressions(t *testing.T) {
+	expr := optimized(t, `1,000 * 60 > 0 && $.a == "x"`)
+	if b, ok := expr.(*BinOp); !ok || b.Operator != "==" {
+		t.Fatalf("expected the && to be removed, got %#v", expr)
+	} else if _, ok := b.Left.(*pathExpr); !ok {
+		t.Errorf("expected the path to be precompiled, got %T", b.Left)
+	}
+
+	expr = optimized(t, `$.name =~ "^" + "A"`)
+	if b, ok := expr.(*BinOp); !ok {
+		t.Errorf("expected a comparison, got %T", expr)
+	} else if _, ok := b.Right.(*RegexLiteral); !ok {
+		t.Errorf("expected the folded pattern to be precompiled, got %T", b.Right)
+	}
+
+	kept := map[string]string{
+		// impure
+		`now() > 0`: "*yap.BinOp",
+		// the error is raised when evaluated
+		`1 / 0`: "*yap.BinOp",
+		// only the truthiness of the right operand is the result
+		`true && $.a`: "*yap.BinOp",
+		// arrays are not shared between evaluations
+		`sort([3, 1, 2])`: "*yap.FuncCall",
+		// lambdas depend on the item
+		`map([1, 2], @ * 2)`: "*yap.FuncCall",
+	}
+
+	for expression, expect := range kept {
+		if expr := optimized(t, expression); fmt.Sprintf("%T", expr) != expect {
+			t.Errorf("%s: expected %s, got %T", expression, expect, expr)
+		}
+	}
+}
+
+func TestOptimizedMatchesTreeWalker(t *testing.T) {
+	var js any
+	if err := json.Unmarshal([]byte(vmJson), &js); err != nil {
+		t.Fatal(err)
+	}
+
+	expressions := append([]string{
+		`1,000 * 60 > 0 && $.name == "Ada"`,
+		`length("abc") + $.threshold`,
+		`false || $.threshold`,
+		`true && ($.threshold > 1)`,
+		`(1 > 2 ? 1 / 0 : $.name) ?? "none"`,
+		`$.name =~ "^" + "A"`,
+		`"(" =~ $.name`,
+		`[1 + 1, { "a": 2 * 3 }]`,
+	}, vmExpressions...)
+
+	for _, expression := range expressions {
+		evaluator, err := NewEvaluator(expression)
+		if err != nil {
+			t.Fatalf("%s: %v", expression, err)
+		}
+
+		walked := encodeResult(evaluator.expression.Eval(newEvalContext(js, nil)))
+		optimized := encodeResult(evaluator.optimized.Eval(newEvalContext(js, nil)))
+
+		if walked != optimized {
+			t.Errorf("%s: tree walker gave %s, optimized program gave %s", expression, walked, optimized)
+		}
+	}
+}
+
+func TestOptimizerRespectsEvaluationSettings(t *testing.T) {
+	runEvaluateTests(t, `{}`, []evaluateTest{
+		{`1 / 3 > 0.3`, `true`},
+		{`"a" == "A"`, `false`},
+	})
+
+	runEvaluateTests(t, `{}`, []evaluateTest{
+		{`1 / 3`, `0.334`},
+	}, WithPrecision(8))
+
+	runEvaluateTests(t, `{}`, []evaluateTest{
+		{`"a" == "A"`, `true`},
+	}, WithCollation(language.English, collate.IgnoreCase))
+}
+
+func TestOptimizerBoundsFolding(t *testing.T) {
+	numbers := make([]string, 40000)
+	for i := range numbers {
+		numbers[i] = fmt.Sprint(i)
+	}
+
+	for _, expression := range []string{
+		fmt.Sprintf(`length(unique([%s]))`, strings.Join(numbers, ", ")),
+		fmt.Sprintf(`length(intersect([%s], [-1]))`, strings.Join(numbers, ", ")),
+		`length(padLeft("a", 100000000))`,
+	} {
+		start := time.Now()
+
+		if expr := optimized(t, expression); isConstant(expr) {
+			t.Errorf("%.40s: expected the call to be kept", expression)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("%.40s: expected folding to give up, took %v", expression, elapsed)
+		}
+
+		evaluator, err := NewEvaluator(expression)
+		if err != nil {
+			t.Fatalf("%.40s: %v", expression, err)
+		}
+
+		if _, err := evaluator.Eval(`{}`, WithMaxSteps(1000)); !errors.As(err, new(*LimitError)) {
+			t.Errorf("%.40s: expected the limits of the evaluation to apply, got %v", expression, err)
+		}
+	}
+}
+
+func TestOptimizerKeepsPanickingCalls(t *testing.T) {
+	registerPureFunctions(map[string]Function{
+		"panics": func(ctx *EvalContext, args []Expr) (interface{}, error) {
+			panic("broken builtin")
+		},
+	})
+	t.Cleanup(func() {
+		delete(BuiltinFunctions, "panics")
+		delete(PureFunctions, "panics")
+	})
+
+	if expr := optimized(t, `panics(1)`); isConstant(expr) {
+		t.Errorf("expected the call to be kept, got %T", expr)
+	}
+
+	if _, err := NewEvaluator(`panics(1) == 1`); err != nil {
+		t.Errorf("expected the expression to compile, got %v", err)
+	}
+}
@@ -0,0 +1,120 @@
+package yap
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Functions evaluating an expression for every item of an array, such as
+// where, filter, map and sortBy, can split large arrays into chunks that
+// are evaluated concurrently. Results keep the order of the array, and an
+// error stops the remaining chunks. As chunks are claimed in order and
+// evaluated to the end unless they fail themselves, every item before a
+// failing one is evaluated, so the error returned is the one evaluating the
+// items in order would return.
+
+// parallelChunk is the number of items a worker evaluates at a time, arrays
+// of at most one chunk are always evaluated on the calling goroutine
+const parallelChunk = 256
+
+// WithParallelism sets the number of goroutines evaluating the items of
+// large arrays, the default of 0 evaluates them in order on the calling
+// goroutine
+func WithParallelism(workers int) EvalOption {
+	return func(ctx *EvalContext) {
+		ctx.Parallelism = workers
+	}
+}
+
+// evalItems evaluates expr with @ bound to every item of arr, the results
+// are in the order of arr
+func evalItems(ctx *EvalContext, expr Expr, arr []any) ([]any, error) {
+	scope, err := newItemScope(ctx, expr)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]any, len(arr))
+
+	chunks := (len(arr) + parallelChunk - 1) / parallelChunk
+	workers := min(ctx.Parallelism, chunks)
+
+	if workers < 2 {
+		for i, item := range arr {
+			var err error
+			if results[i], err = scope.eval(item); err != nil {
+				return nil, err
+			}
+		}
+
+		return results, nil
+	}
+
+	// loops nested in the expression run on the worker evaluating it
+	sequential := *ctx
+	sequential.Parallelism = 0
+
+	var (
+		wg     sync.WaitGroup
+		next   atomic.Int64
+		failed atomic.Bool
+		mu     sync.Mutex
+		first  = len(arr)
+	)
+
+	for range workers {
+		wg.Go(func() {
+			// the depth was checked for the scope above
+			scope, _ := newItemScope(&sequential, expr)
+
+			for !failed.Load() {
+				start := int(next.Add(parallelChunk)) - parallelChunk
+				if start >= len(arr) {
+					return
+				}
+
+				for i := start; i < min(start+parallelChunk, len(arr)); i++ {
+					value, itemErr := scope.eval(arr[i])
+
+					if itemErr != nil {
+						mu.Lock()
+						if i < first {
+							first, err = i, itemErr
+						}
+						mu.Unlock()
+
+						failed.Store(true)
+						return
+					}
+
+					results[i] = value
+				}
+			}
+		})
+	}
+
+	wg.Wait()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// filterItems returns the items of arr for which cond is true
+func filterItems(ctx *EvalContext, cond Expr, arr []any) ([]any, error) {
+	results, err := evalItems(ctx, cond, arr)
+	if err != nil {
+		return nil, err
+	}
+
+	matches := []any{}
+	for i, item := range arr {
+		if toBoolean(results[i]) {
+			matches = append(matches, item)
+		}
+	}
+
+	return matches, nil
+}
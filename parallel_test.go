@@ -0,0 +1,160 @@
+package yap
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// largeArray is a document whose items array spans many chunks
+func largeArray(size int, item func(i int) string) string {
+	items := make([]string, size)
+	for i := range items {
+		items[i] = item(i)
+	}
+
+	return fmt.Sprintf(`{"threshold": 500, "items": [%s]}`, strings.Join(items, ","))
+}
+
+func TestParallelMatchesSequential(t *testing.T) {
+	data := largeArray(3000, func(i int) string {
+		return fmt.Sprintf(`{"id": %d, "v": %d, "tags": ["t%d"]}`, i, (i*7919)%1000, i%3)
+	})
+
+	expressions := []string{
+		`where($.items, @.v > $.threshold)`,
+		`filter($.items, x => x.v < 100 || x.v > 900)`,
+		`map($.items, @.v * 2 + $.threshold)`,
+		`map($.items, x => { "id": x.id, "small": where(x.tags, @ == "t1") })`,
+		`count($.items, @.v >= 990)`,
+		`map(sortBy($.items, @.v), @.id)`,
+		`map(groupBy($.items, @.tags[0]), length(@))`,
+		`map($.items, x => count(x.tags, @ == "t1" && x.v > $.threshold))`,
+		`reduce(where($.items, @.v < 5), 0, @acc + @.v)`,
+		`map($.items, @.v > 998 ? @.missing.key : @.v)`,
+		`map($.items, @.id == 1000 ? @.nope : @.id == 2500 ? 1 / 0 : @.id)`,
+	}
+
+	for _, expression := range expressions {
+		evaluator, err := NewEvaluator(expression)
+		if err != nil {
+			t.Fatalf("%s: %v", expression, err)
+		}
+
+		sequential := encodeResult(evaluator.Eval(data))
+
+		for _, workers := range []int{2, 8} {
+			parallel := encodeResult(evaluator.Eval(data, WithParallelism(workers)))
+
+			if parallel != sequential {
+				t.Errorf("%s with %d workers: expected %.200s, got %.200s", expression, workers, sequential, parallel)
+			}
+		}
+	}
+}
+
+func TestParallelStopsAtFirstError(t *testing.T) {
+	data := largeArray(100000, func(i int) string {
+		if i == 1000 {
+			return `"not an object"`
+		}
+		return fmt.Sprintf(`{"id": %d}`, i)
+	})
+
+	evaluator, err := NewEvaluator(`map($.items, visit(@.id))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var js any
+	if err := json.Unmarshal([]byte(data), &js); err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	visited := map[any]bool{}
+
+	ctx := newEvalContext(js, []EvalOption{WithParallelism(4)})
+	ctx.FuncMap = maps.Clone(BuiltinFunctions)
+	ctx.FuncMap["visit"] = func(ctx *EvalContext, args []Expr) (interface{}, error) {
+		id, err := args[0].Eval(ctx)
+		if err == nil {
+			mu.Lock()
+			visited[id] = true
+			mu.Unlock()
+		}
+		return id, err
+	}
+
+	if _, err := evaluator.program.Eval(ctx); err == nil {
+		t.Fatal("expected the item at 1000 to fail")
+	}
+
+	// every item before the failing one is evaluated, the chunks after
+	// those in flight are not
+	for i := range 1000 {
+		if !visited[float64(i)] {
+			t.Fatalf("expected item %d to be evaluated", i)
+		}
+	}
+	if len(visited) > 1000+4*parallelChunk {
+		t.Errorf("expected evaluation to stop, %d items were evaluated", len(visited))
+	}
+}
+
+func TestItemScopeIsReused(t *testing.T) {
+	evaluator, err := NewEvaluator(`where($.items, @.v > $.threshold)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	allocs := func(size int) float64 {
+		var js any
+		data := largeArray(size, func(i int) string { return fmt.Sprintf(`{"v": %d}`, i) })
+		if err := json.Unmarshal([]byte(data), &js); err != nil {
+			t.Fatal(err)
+		}
+		ctx := newEvalContext(js, nil)
+
+		return testing.AllocsPerRun(20, func() {
+			if _, err := evaluator.optimized.Eval(ctx); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+
+	// only the growing result allocates per item count
+	if small, large := allocs(10), allocs(400); large > small+12 {
+		t.Errorf("expected allocations independent of the items, got %v for 10 and %v for 400", small, large)
+	}
+}
+
+func BenchmarkParallelWhere(b *testing.B) {
+	data := largeArray(200000, func(i int) string {
+		return fmt.Sprintf(`{"v": %d, "name": "item %d"}`, i%1000, i)
+	})
+
+	var js any
+	if err := json.Unmarshal([]byte(data), &js); err != nil {
+		b.Fatal(err)
+	}
+
+	evaluator, err := NewEvaluator(`where($.items, @.v > $.threshold && @.name =~ "7$")`)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, workers := range []int{0, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			ctx := newEvalContext(js, []EvalOption{WithParallelism(workers)})
+			for b.Loop() {
+				if _, err := evaluator.optimized.Eval(ctx); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
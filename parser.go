@@ -3,11 +3,39 @@ package yap
 import (
 	"fmt"
 	"math/big"
+	"regexp"
+	"time"
 )
 
+// binaryPrecedence maps each binary operator to its binding power,
+// operators with a higher value bind tighter
+var binaryPrecedence = map[string]int{
+	"??": 1,
+	"||": 2,
+	"&&": 3,
+	"==": 4,
+	"!=": 4,
+	"=~": 4,
+	"!~": 4,
+	"<":  5,
+	">":  5,
+	"<=": 5,
+	">=": 5,
+	"+":  6,
+	"-":  6,
+	"*":  7,
+	"/":  7,
+}
+
+// lambdaParamPattern matches the plain names a lambda can bind
+var lambdaParamPattern = regexp.MustCompile(`^[\p{L}_][\p{L}\p{N}_]*$`)
+
 type Parser struct {
 	tokens []*Token
 	pos    int
+	limits parseLimits
+	// nesting is the number of expressions enclosing the one being parsed
+	nesting int
 }
 
 func (p *Parser) currentToken() *Token {
@@ -30,25 +58,71 @@ func (p *Parser) peekToken() *Token {
 	return p.tokens[p.pos+1]
 }
 
-func (p *Parser) parseBinaryOp(left Expr) (Expr, error) {
-	p.advance() // consume operator
+// isPunctuation reports whether the current token is the given punctuation
+func (p *Parser) isPunctuation(literal string) bool {
+	token := p.currentToken()
+	return token != nil && token.Type == Punctuation && token.Literal == literal
+}
 
-	operand := p.currentToken()
-	p.advance() // consume right
+// expect consumes the given punctuation or fails
+func (p *Parser) expect(literal string) error {
+	token := p.currentToken()
 
-	right, err := p.parseExpression()
+	if token == nil {
+		return fmt.Errorf("expected '%s', got end of input", literal)
+	}
+
+	if token.Type != Punctuation || token.Literal != literal {
+		return fmt.Errorf("expected '%s', got '%s'", literal, token.Literal)
+	}
+
+	p.advance()
+	return nil
+}
+
+// parseBinaryOp parses binary operators by precedence climbing, only
+// operators binding at least as tight as minPrecedence are consumed
+func (p *Parser) parseBinaryOp(minPrecedence int) (Expr, error) {
+	left, err := p.parsePrimary()
 
 	if err != nil {
 		return nil, err
 	}
 
-	binOp := &BinOp{
-		Left:     left,
-		Operator: operand.Literal,
-		Right:    right,
+	for {
+		operator := p.currentToken()
+
+		if operator == nil || operator.Type != BinaryOperator {
+			break
+		}
+
+		precedence, ok := binaryPrecedence[operator.Literal]
+
+		if !ok {
+			return nil, fmt.Errorf("unsupported operator: %s", operator.Literal)
+		}
+
+		if precedence < minPrecedence {
+			break
+		}
+
+		p.advance() // consume operator
+
+		// operators are left associative
+		right, err := p.parseBinaryOp(precedence + 1)
+
+		if err != nil {
+			return nil, err
+		}
+
+		left = &BinOp{
+			Left:     left,
+			Operator: operator.Literal,
+			Right:    right,
+		}
 	}
 
-	return binOp, nil
+	return left, nil
 }
 
 func (p *Parser) parseFunctionCall(ident *Ident) (Expr, error) {
@@ -62,48 +136,104 @@ func (p *Parser) parseFunctionCall(ident *Ident) (Expr, error) {
 	// consume '('
 	p.advance()
 
-	for {
-		token := p.currentToken() // current token == func2
+	args, err := p.parseList(")")
 
-		if token == nil {
-			break
-		}
-		if token.Type == Punctuation && token.Literal == ")" {
-			break
-		}
+	if err != nil {
+		return nil, err
+	}
 
-		if token.Type == Punctuation && token.Literal == "," {
-			p.advance() // consume ','
-			continue
+	funcCall.Args = args
+
+	return funcCall, nil
+}
+
+// parseList parses comma separated expressions up to and including the
+// closing punctuation
+func (p *Parser) parseList(closing string) ([]Expr, error) {
+	exprs := []Expr{}
+
+	for !p.isPunctuation(closing) {
+		if p.currentToken() == nil {
+			return nil, fmt.Errorf("expected '%s', got end of input", closing)
 		}
 
-		arg, err := p.parseExpression()
+		expr, err := p.parseExpression()
 		if err != nil {
 			return nil, err
 		}
 
-		funcCall.Args = append(funcCall.Args, arg)
-
-		p.advance()
+		exprs = append(exprs, expr)
 
+		if !p.isPunctuation(closing) {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
 	}
-	return funcCall, nil
+
+	// consume closing
+	p.advance()
+
+	return exprs, nil
 }
 
-func (p *Parser) parseOp(left Expr) (Expr, error) {
+func (p *Parser) parseArray() (Expr, error) {
+	// consume '['
+	p.advance()
 
-	nextToken := p.peekToken()
+	elements, err := p.parseList("]")
 
-	if nextToken == nil {
-		return left, nil
+	if err != nil {
+		return nil, err
 	}
 
-	switch nextToken.Type {
-	case BinaryOperator:
-		return p.parseBinaryOp(left)
+	return &ArrayLiteral{Elements: elements}, nil
+}
+
+func (p *Parser) parseObject() (Expr, error) {
+	// consume '{'
+	p.advance()
+
+	object := &ObjectLiteral{}
+
+	for !p.isPunctuation("}") {
+		key := p.currentToken()
+
+		if key == nil {
+			return nil, fmt.Errorf("expected '}', got end of input")
+		}
+
+		// keys are either quoted strings or bare identifiers
+		if key.Type != String && key.Type != Identifier {
+			return nil, fmt.Errorf("unexpected object key: %s", key.Literal)
+		}
+
+		p.advance() // consume key
+
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+
+		value, err := p.parseExpression()
+
+		if err != nil {
+			return nil, err
+		}
+
+		object.Keys = append(object.Keys, key.Literal)
+		object.Values = append(object.Values, value)
+
+		if !p.isPunctuation("}") {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
 	}
 
-	return left, nil
+	// consume '}'
+	p.advance()
+
+	return object, nil
 }
 
 func (p *Parser) parseIdentifier() (Expr, error) {
@@ -112,6 +242,15 @@ func (p *Parser) parseIdentifier() (Expr, error) {
 		return nil, fmt.Errorf("unexpected end of input")
 	}
 
+	switch token.Literal {
+	case "true", "false":
+		p.advance()
+		return &Literal[bool]{Value: token.Literal == "true"}, nil
+	case "null":
+		p.advance()
+		return &NullLiteral{}, nil
+	}
+
 	ident := &Ident{Name: token.Literal}
 	nextToken := p.peekToken()
 
@@ -119,9 +258,34 @@ func (p *Parser) parseIdentifier() (Expr, error) {
 		return p.parseFunctionCall(ident)
 	}
 
+	if nextToken != nil && nextToken.Type == Punctuation && nextToken.Literal == "=>" {
+		return p.parseLambda(ident)
+	}
+
+	p.advance()
 	return ident, nil
 }
 
+// parseLambda parses a named binding, e.g. o => o.total > $.threshold
+func (p *Parser) parseLambda(ident *Ident) (Expr, error) {
+	if !lambdaParamPattern.MatchString(ident.Name) {
+		return nil, fmt.Errorf("invalid lambda parameter: %s", ident.Name)
+	}
+
+	// consume parameter
+	p.advance()
+	// consume '=>'
+	p.advance()
+
+	body, err := p.parseExpression()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Lambda{Param: ident.Name, Body: body}, nil
+}
+
 func (p *Parser) parseLiteral() (Expr, error) {
 	token := p.currentToken()
 	if token == nil {
@@ -130,9 +294,19 @@ func (p *Parser) parseLiteral() (Expr, error) {
 
 	switch token.Type {
 	case String:
+		p.advance()
 		return &Literal[string]{Value: token.Literal}, nil
 	case Numeric:
+		p.advance()
+
+		// integers are kept native, see nativeInt
+		if i, wide, ok := nativeInt(token.Numeric); ok && wide {
+			return &Literal[int64]{Value: i}, nil
+		}
 		return &Literal[*big.Float]{Value: token.Numeric}, nil
+	case Duration:
+		p.advance()
+		return &Literal[time.Duration]{Value: token.Duration}, nil
 	case Identifier:
 		return p.parseIdentifier()
 	default:
@@ -140,35 +314,125 @@ func (p *Parser) parseLiteral() (Expr, error) {
 	}
 }
 
-func (p *Parser) parseExpression() (Expr, error) {
-
+func (p *Parser) parsePrimary() (Expr, error) {
 	token := p.currentToken()
 	if token == nil {
-		return nil, nil
+		return nil, fmt.Errorf("unexpected end of input")
 	}
 
-	switch token.Type {
-	case Identifier:
-		left, err := p.parseIdentifier()
+	// prefix operators bind tighter than any binary operator
+	if token.Type == BinaryOperator && (token.Literal == "-" || token.Literal == "!") {
+		p.advance() // consume operator
+
+		// the operand nests like a parenthesized expression, e.g. !!!a
+		operand, err := p.parseNested(p.parsePrimary)
 		if err != nil {
 			return nil, err
 		}
-		return p.parseOp(left)
-	case String, Numeric:
-		left, err := p.parseLiteral()
+
+		return &UnaryOp{Operator: token.Literal, Operand: operand}, nil
+	}
+
+	if token.Type != Punctuation {
+		return p.parseLiteral()
+	}
+
+	switch token.Literal {
+	case "(":
+		p.advance() // consume '('
+
+		expr, err := p.parseExpression()
 		if err != nil {
 			return nil, err
 		}
-		return left, nil
+
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+
+		return expr, nil
+	case "[":
+		return p.parseArray()
+	case "{":
+		return p.parseObject()
 	default:
 		return nil, fmt.Errorf("unexpected token: %s", token.Literal)
 	}
 }
 
+// parseConditional parses cond ? a : b, which binds looser than any binary
+// operator and is right associative, a ? b : c ? d : e == a ? b : (c ? d : e)
+func (p *Parser) parseConditional() (Expr, error) {
+	condition, err := p.parseBinaryOp(0)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.isPunctuation("?") {
+		return condition, nil
+	}
+
+	p.advance() // consume '?'
+
+	then, err := p.parseConditional()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.expect(":"); err != nil {
+		return nil, err
+	}
+
+	otherwise, err := p.parseConditional()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Conditional{
+		Condition: condition,
+		Then:      then,
+		Else:      otherwise,
+	}, nil
+}
+
+// parseExpression parses a whole expression, which is nested in the
+// expressions being parsed
+func (p *Parser) parseExpression() (Expr, error) {
+	return p.parseNested(p.parseConditional)
+}
+
+// parseNested parses an expression nested in the expressions being parsed,
+// counting it against maxNesting
+func (p *Parser) parseNested(parse func() (Expr, error)) (Expr, error) {
+	p.nesting++
+	defer func() { p.nesting-- }()
+
+	if p.limits.maxNesting > 0 && p.nesting > p.limits.maxNesting {
+		return nil, &LimitError{Limit: NestingLimit, Max: p.limits.maxNesting}
+	}
+
+	return parse()
+}
+
 func (p *Parser) Parse() (Expr, error) {
-	return p.parseExpression()
+	if p.currentToken() == nil {
+		return nil, fmt.Errorf("unexpected end of input")
+	}
+
+	expr, err := p.parseExpression()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if token := p.currentToken(); token != nil {
+		return nil, fmt.Errorf("unexpected token: %s", token.Literal)
+	}
+
+	return expr, nil
 }
 
-func NewParser(tokens []*Token) *Parser {
-	return &Parser{tokens: tokens}
+func NewParser(tokens []*Token, opts ...ParseOption) *Parser {
+	return &Parser{tokens: tokens, limits: newParseLimits(opts)}
 }
@@ -0,0 +1,290 @@
+package yap
+
+import (
+	"container/list"
+	"fmt"
+	"regexp"
+	"sync"
+)
+
+// Regular expressions use Go's RE2 syntax, matching runs in time linear
+// in the input so user supplied patterns cannot backtrack catastrophically.
+
+// RegexCacheSize bounds the number of dynamic patterns kept compiled
+const RegexCacheSize = 256
+
+// RegexLiteral is a pattern known when the expression is compiled, it is
+// compiled once instead of on every evaluation
+type RegexLiteral struct {
+	Pattern string
+	Regexp  *regexp.Regexp
+	// Anchored matches whole strings only, it is compiled for the
+	// pattern of match
+	Anchored *regexp.Regexp
+}
+
+func (r *RegexLiteral) Node() Expr {
+	return r
+}
+
+func (r *RegexLiteral) Eval(ctx *EvalContext) (interface{}, error) {
+	return r.Pattern, nil
+}
+
+// regexCache is a least recently used cache of compiled patterns
+type regexCache struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List
+	entries  map[string]*list.Element
+}
+
+type regexEntry struct {
+	pattern string
+	regexp  *regexp.Regexp
+}
+
+func newRegexCache(capacity int) *regexCache {
+	return &regexCache{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  map[string]*list.Element{},
+	}
+}
+
+func (c *regexCache) Get(pattern string) (*regexp.Regexp, error) {
+	c.mu.Lock()
+	if element, exists := c.entries[pattern]; exists {
+		c.order.MoveToFront(element)
+		c.mu.Unlock()
+		return element.Value.(*regexEntry).regexp, nil
+	}
+	c.mu.Unlock()
+
+	// compile outside the lock, a concurrent compile of the same
+	// pattern is harmless
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regular expression %q: %w", pattern, err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, exists := c.entries[pattern]; !exists {
+		c.entries[pattern] = c.order.PushFront(&regexEntry{pattern: pattern, regexp: re})
+
+		if c.order.Len() > c.capacity {
+			oldest := c.order.Back()
+			c.order.Remove(oldest)
+			delete(c.entries, oldest.Value.(*regexEntry).pattern)
+		}
+	}
+
+	return re, nil
+}
+
+var dynamicRegexes = newRegexCache(RegexCacheSize)
+
+// toRegexp returns the compiled pattern for an evaluated regex argument
+func toRegexp(expr Expr, value any) (*regexp.Regexp, error) {
+	if literal, ok := expr.(*RegexLiteral); ok {
+		return literal.Regexp, nil
+	}
+
+	pattern, ok := value.(string)
+
+	if !ok {
+		return nil, fmt.Errorf("regular expression must be a string, got %T", value)
+	}
+
+	return dynamicRegexes.Get(pattern)
+}
+
+// anchor returns a pattern matching whole strings only. The pattern is
+// anchored rather than comparing the leftmost match with the string, so
+// alternations like a|ab still match "ab".
+func anchor(pattern string) string {
+	return `^(?:` + pattern + `)$`
+}
+
+// regexArgs lists the argument position of the pattern per regex function
+var regexArgs = map[string]int{
+	"match":     1,
+	"search":    1,
+	"replaceRe": 1,
+	"capture":   1,
+}
+
+// compileRegex replaces a literal pattern of the operator or function name
+// with a precompiled RegexLiteral, other expressions are returned
+// unchanged. The pattern of match is compiled anchored too.
+func compileRegex(name string, expr Expr) (Expr, error) {
+	literal, ok := expr.(*Literal[string])
+
+	if !ok {
+		return expr, nil
+	}
+
+	re, err := regexp.Compile(literal.Value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regular expression %q: %w", literal.Value, err)
+	}
+
+	compiled := &RegexLiteral{Pattern: literal.Value, Regexp: re}
+
+	if name == "match" {
+		// a valid pattern stays valid when anchored
+		compiled.Anchored = regexp.MustCompile(anchor(literal.Value))
+	}
+
+	return compiled, nil
+}
+
+// compileRegexes replaces literal patterns of =~, !~ and the regex
+// functions with precompiled RegexLiterals, invalid patterns fail here
+func compileRegexes(expr Expr) (Expr, error) {
+	return rewrite(expr, func(expr Expr) (Expr, error) {
+		var err error
+
+		switch e := expr.(type) {
+		case *BinOp:
+			if e.Operator == "=~" || e.Operator == "!~" {
+				e.Right, err = compileRegex(e.Operator, e.Right)
+			}
+		case *FuncCall:
+			if i, ok := regexArgs[e.Name]; ok && i < len(e.Args) {
+				e.Args[i], err = compileRegex(e.Name, e.Args[i])
+			}
+		}
+
+		return expr, err
+	})
+}
+
+// evalRegexArgs evaluates the subject string and pattern of a regex function
+func evalRegexArgs(ctx *EvalContext, name string, args []Expr) (string, *regexp.Regexp, error) {
+	str, err := evalString(ctx, name, args[0])
+	if err != nil {
+		return "", nil, err
+	}
+
+	pattern, err := args[1].Eval(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+
+	re, err := toRegexp(args[1], pattern)
+	if err != nil {
+		return "", nil, fmt.Errorf("%s function: %w", name, err)
+	}
+
+	return str, re, nil
+}
+
+func init() {
+	registerPureFunctions(regexFunctions)
+}
+
+var regexFunctions = map[string]Function{
+	// match(str, re) is true when re matches the whole string
+	"match": func(ctx *EvalContext, args []Expr) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, fmt.Errorf("match function requires exactly 2 arguments")
+		}
+		str, re, err := evalRegexArgs(ctx, "match", args)
+		if err != nil {
+			return nil, err
+		}
+
+		if literal, ok := args[1].(*RegexLiteral); ok && literal.Anchored != nil {
+			return literal.Anchored.MatchString(str), nil
+		}
+
+		anchored, err := dynamicRegexes.Get(anchor(re.String()))
+		if err != nil {
+			return nil, err
+		}
+
+		return anchored.MatchString(str), nil
+	},
+
+	// search(str, re) returns the first substring matched by re, or null
+	"search": func(ctx *EvalContext, args []Expr) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, fmt.Errorf("search function requires exactly 2 arguments")
+		}
+		str, re, err := evalRegexArgs(ctx, "search", args)
+		if err != nil {
+			return nil, err
+		}
+
+		loc := re.FindStringIndex(str)
+		if loc == nil {
+			return nil, nil
+		}
+
+		return str[loc[0]:loc[1]], nil
+	},
+
+	// replaceRe(str, re, repl) replaces every match, repl may refer to
+	// groups as $1 or ${name}
+	"replaceRe": func(ctx *EvalContext, args []Expr) (interface{}, error) {
+		if len(args) != 3 {
+			return nil, fmt.Errorf("replaceRe function requires exactly 3 arguments")
+		}
+		str, re, err := evalRegexArgs(ctx, "replaceRe", args)
+		if err != nil {
+			return nil, err
+		}
+		repl, err := evalString(ctx, "replaceRe", args[2])
+		if err != nil {
+			return nil, err
+		}
+
+		return re.ReplaceAllString(str, repl), nil
+	},
+
+	// capture(str, re) returns the groups of the first match, an object
+	// when the pattern names its groups and an array otherwise, or null
+	"capture": func(ctx *EvalContext, args []Expr) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, fmt.Errorf("capture function requires exactly 2 arguments")
+		}
+		str, re, err := evalRegexArgs(ctx, "capture", args)
+		if err != nil {
+			return nil, err
+		}
+
+		groups := re.FindStringSubmatchIndex(str)
+		if groups == nil {
+			return nil, nil
+		}
+
+		group := func(i int) any {
+			if groups[2*i] < 0 {
+				return nil
+			}
+			return str[groups[2*i]:groups[2*i+1]]
+		}
+
+		names := re.SubexpNames()
+		named := map[string]any{}
+		for i, name := range names {
+			if name != "" {
+				named[name] = group(i)
+			}
+		}
+
+		if len(named) > 0 {
+			return named, nil
+		}
+
+		captures := make([]any, 0, len(names)-1)
+		for i := 1; i < len(names); i++ {
+			captures = append(captures, group(i))
+		}
+
+		return captures, nil
+	},
+}
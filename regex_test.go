@@ -0,0 +1,81 @@
+package yap
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRegex(t *testing.T) {
+	data := `{"email": "Bob@Example.com", "pattern": "^b", "date": "2024-05-17"}`
+
+	runEvaluateTests(t, data, []evaluateTest{
+		{`$.email =~ "(?i)example\\.com$"`, `true`},
+		{`$.email !~ "^bob"`, `true`},
+		{`lower($.email) =~ $.pattern`, `true`},
+		{`match($.date, "\\d{4}-\\d{2}-\\d{2}")`, `true`},
+		{`match($.date, "\\d{4}")`, `false`},
+		{`match("ab", "a|ab")`, `true`},
+		{`search($.email, "@[a-zA-Z]+")`, `"@Example"`},
+		{`search($.email, "\\d+")`, `null`},
+		{`replaceRe($.date, "(\\d+)-(\\d+)-(\\d+)", "$3.$2.$1")`, `"17.05.2024"`},
+		{`capture($.date, "(?P<year>\\d+)-(?P<month>\\d+)")`, `{"month":"05","year":"2024"}`},
+		{`capture($.date, "(\\d+)-(\\d+)")`, `["2024","05"]`},
+	})
+}
+
+func TestRegexCompiledOnce(t *testing.T) {
+	evaluator, err := NewEvaluator(`$.a =~ "^x" && match($.a, $.b)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	op := evaluator.expression.(*BinOp).Left.(*BinOp)
+	if _, ok := op.Right.(*RegexLiteral); !ok {
+		t.Errorf("expected literal pattern to be precompiled, got %T", op.Right)
+	}
+
+	if _, err := NewEvaluator(`$.a =~ "("`); err == nil {
+		t.Errorf("expected invalid literal pattern to fail at compile time")
+	}
+
+	// a pattern folded by the optimizer is only precompiled in the
+	// optimized program
+	tests := map[string][]EvalOption{
+		`match($.a, "lit|literal")`:      {WithPrecision(8)},
+		`match($.a, "fold" + "|folded")`: nil,
+	}
+
+	for expression, opts := range tests {
+		evaluator, err := NewEvaluator(expression)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if result, err := evaluator.Eval(`{"a": "literal folded"}`, opts...); err != nil || result != false {
+			t.Errorf("%s: expected no match, got %v %v", expression, result, err)
+		}
+	}
+
+	dynamicRegexes.mu.Lock()
+	defer dynamicRegexes.mu.Unlock()
+
+	for _, pattern := range []string{anchor("lit|literal"), anchor("fold|folded")} {
+		if _, exists := dynamicRegexes.entries[pattern]; exists {
+			t.Errorf("expected the anchored pattern %s to be precompiled", pattern)
+		}
+	}
+}
+
+func TestRegexCacheBounded(t *testing.T) {
+	cache := newRegexCache(2)
+
+	for i := 0; i < 5; i++ {
+		if _, err := cache.Get(fmt.Sprintf("a{%d}", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if cache.order.Len() != 2 || len(cache.entries) != 2 {
+		t.Errorf("expected cache to hold 2 patterns, got %d", len(cache.entries))
+	}
+}
@@ -0,0 +1,503 @@
+package yap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// RuleSet evaluates many named rules against a document at once. The
+// document is decoded once for all rules, and subexpressions found in
+// several rules, e.g. a path or $.type == "order", are evaluated once per
+// document. Rules may be added and removed while evaluations run, an
+// evaluation uses the rules present when it started.
+type RuleSet struct {
+	mu    sync.Mutex
+	opts  []ParseOption
+	rules map[string]*Evaluator
+	// compiled is nil when rules changed since the rules were last compiled
+	compiled atomic.Pointer[compiledRules]
+}
+
+// RuleSetResult is the outcome of evaluating a RuleSet
+type RuleSetResult struct {
+	// Matched lists the names of the rules that evaluated to true, sorted
+	Matched []string
+	// Errors holds the error of every rule that failed to evaluate
+	Errors map[string]error
+}
+
+// NewRuleSet creates an empty RuleSet, opts apply to every rule added
+func NewRuleSet(opts ...ParseOption) *RuleSet {
+	return &RuleSet{opts: opts, rules: map[string]*Evaluator{}}
+}
+
+// Add adds a rule, replacing any rule with the same name
+func (s *RuleSet) Add(name string, expression string) error {
+	evaluator, err := NewEvaluator(expression, s.opts...)
+	if err != nil {
+		return fmt.Errorf("rule %s: %w", name, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rules[name] = evaluator
+	s.compiled.Store(nil)
+
+	return nil
+}
+
+// Remove removes a rule and reports whether it existed
+func (s *RuleSet) Remove(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.rules[name]; !exists {
+		return false
+	}
+
+	delete(s.rules, name)
+	s.compiled.Store(nil)
+
+	return true
+}
+
+// Eval evaluates every rule against data, an error is returned only when
+// data cannot be decoded. Each rule is evaluated with its own steps, a
+// subexpression shared by several rules counts towards the first rule
+// evaluating it within its limits.
+func (s *RuleSet) Eval(data string, opts ...EvalOption) (*RuleSetResult, error) {
+	rules, err := s.compile()
+	if err != nil {
+		return nil, err
+	}
+
+	js, err := decodeDocument([]byte(data), rules.paths)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := newEvalContext(js, opts)
+
+	programs := rules.programs
+	if foldable(ctx) {
+		programs = rules.optimized
+	}
+
+	ctx.shared = make([]sharedValue, programs.shared*missingKeyModes)
+
+	result := &RuleSetResult{Matched: []string{}}
+
+	for i, program := range programs.programs {
+		ctx.countSteps()
+		value, err := program.Eval(ctx)
+
+		if err != nil {
+			if result.Errors == nil {
+				result.Errors = map[string]error{}
+			}
+			result.Errors[rules.names[i]] = err
+		} else if toBoolean(value) {
+			result.Matched = append(result.Matched, rules.names[i])
+		}
+	}
+
+	return result, nil
+}
+
+// compiledRules are the rules of a RuleSet compiled together
+type compiledRules struct {
+	names []string
+	paths *pathTree
+	// programs and optimized are the programs of the plain and optimized
+	// expressions, like the programs of an Evaluator
+	programs  *sharedPrograms
+	optimized *sharedPrograms
+}
+
+// sharedPrograms are the programs of several rules and the number of
+// subexpressions they share
+type sharedPrograms struct {
+	programs []*program
+	shared   int
+}
+
+// compile returns the compiled rules, compiling them when rules changed
+func (s *RuleSet) compile() (*compiledRules, error) {
+	if rules := s.compiled.Load(); rules != nil {
+		return rules, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if rules := s.compiled.Load(); rules != nil {
+		return rules, nil
+	}
+
+	rules := &compiledRules{paths: &pathTree{}}
+
+	for name := range s.rules {
+		rules.names = append(rules.names, name)
+	}
+	slices.Sort(rules.names)
+
+	plain := make([]Expr, len(rules.names))
+	optimized := make([]Expr, len(rules.names))
+
+	for i, name := range rules.names {
+		plain[i] = s.rules[name].expression
+		optimized[i] = optimize(plain[i])
+
+		collect(plain[i], rules.paths, map[string]bool{})
+	}
+
+	var err error
+
+	if rules.programs, err = compileShared(plain); err != nil {
+		return nil, err
+	}
+	if rules.optimized, err = compileShared(optimized); err != nil {
+		return nil, err
+	}
+
+	s.compiled.Store(rules)
+
+	return rules, nil
+}
+
+// missingKeyModes is the number of MissingKeyMode values, a shared
+// subexpression has a value per mode as ?? and exists() evaluate their
+// operands leniently
+const missingKeyModes = 3
+
+// sharedValue is the value of a shared subexpression, computed once. An
+// evaluation stopped by a limit or the context is not kept, the limits
+// apply to the rule evaluating it and the next rule evaluates it again
+// with its own steps.
+type sharedValue struct {
+	mu    sync.Mutex
+	done  bool
+	value any
+	err   error
+}
+
+// sharedExpr is a subexpression common to several rules, evaluated once
+// per document and missing key mode
+type sharedExpr struct {
+	index int
+	expr  Expr
+}
+
+func (s *sharedExpr) Node() Expr {
+	return s
+}
+
+func (s *sharedExpr) Eval(ctx *EvalContext) (interface{}, error) {
+	if ctx.shared == nil {
+		return s.expr.Eval(ctx)
+	}
+
+	shared := &ctx.shared[s.index*missingKeyModes+int(ctx.MissingKeys)]
+
+	shared.mu.Lock()
+	defer shared.mu.Unlock()
+
+	if !shared.done {
+		value, err := s.expr.Eval(ctx)
+		if stopped(err) {
+			return nil, err
+		}
+
+		shared.value, shared.err, shared.done = value, err, true
+	}
+
+	return shared.value, shared.err
+}
+
+// stopped reports whether err stopped an evaluation because of a limit or
+// its context rather than the document
+func stopped(err error) bool {
+	return errors.As(err, new(*LimitError)) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// compileShared compiles exprs with their common subexpressions shared
+func compileShared(exprs []Expr) (*sharedPrograms, error) {
+	s := &sharing{counts: map[string]int{}, nodes: map[string]*sharedExpr{}}
+
+	for _, expr := range exprs {
+		if _, _, err := s.visit(expr, false); err != nil {
+			return nil, err
+		}
+	}
+
+	programs := &sharedPrograms{programs: make([]*program, len(exprs))}
+
+	for i, expr := range exprs {
+		rewritten, _, err := s.visit(expr, true)
+		if err != nil {
+			return nil, err
+		}
+
+		if programs.programs[i], err = compile(rewritten); err != nil {
+			return nil, err
+		}
+	}
+
+	// a shared subexpression is compiled once for all rules using it
+	for _, node := range s.nodes {
+		compiled, err := compile(node.expr)
+		if err != nil {
+			return nil, err
+		}
+		node.expr = compiled
+	}
+
+	programs.shared = len(s.nodes)
+
+	return programs, nil
+}
+
+// sharing finds the subexpressions of several expressions which occur
+// more than once
+type sharing struct {
+	counts map[string]int
+	nodes  map[string]*sharedExpr
+}
+
+// shareable is a subexpression's canonical text, it is empty when the
+// subexpression cannot be shared
+type shareable struct {
+	key string
+	// free lists the scope bindings the subexpression reads without
+	// binding them itself, @ names and lambda parameters
+	free []string
+}
+
+// visit counts the subexpressions of expr, or with rewrite replaces
+// those counted more than once by a sharedExpr. A subexpression is shared
+// when it only calls pure functions and reads no binding of an enclosing
+// scope, so its value is the same wherever it occurs.
+func (s *sharing) visit(expr Expr, rewrite bool) (Expr, shareable, error) {
+	var b strings.Builder
+	var free []string
+	pure := true
+
+	// child visits an operand, writing its key
+	child := func(expr Expr) (Expr, error) {
+		rewritten, sub, err := s.visit(expr, rewrite)
+		if err != nil {
+			return nil, err
+		}
+
+		if sub.key == "" {
+			pure = false
+		}
+		b.WriteString(sub.key)
+		free = append(free, sub.free...)
+
+		return rewritten, nil
+	}
+
+	children := func(exprs []Expr) ([]Expr, error) {
+		rewritten := make([]Expr, len(exprs))
+		for i, expr := range exprs {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+
+			var err error
+			if rewritten[i], err = child(expr); err != nil {
+				return nil, err
+			}
+		}
+		return rewritten, nil
+	}
+
+	var err error
+
+	switch e := expr.(type) {
+	case *Ident:
+		return s.visitPath(expr, e.Name, rewrite)
+	case *pathExpr:
+		names := make([]string, len(e.path.Segments))
+		for i, segment := range e.path.Segments {
+			names[i] = segment.Name
+		}
+		return s.visitPath(expr, strings.Join(names, "."), rewrite)
+	case *BinOp:
+		node := &BinOp{Operator: e.Operator}
+		b.WriteByte('(')
+		if node.Left, err = child(e.Left); err != nil {
+			return nil, shareable{}, err
+		}
+		b.WriteString(e.Operator)
+		if node.Right, err = child(e.Right); err != nil {
+			return nil, shareable{}, err
+		}
+		b.WriteByte(')')
+		expr = node
+	case *UnaryOp:
+		node := &UnaryOp{Operator: e.Operator}
+		b.WriteString("(" + e.Operator)
+		if node.Operand, err = child(e.Operand); err != nil {
+			return nil, shareable{}, err
+		}
+		b.WriteByte(')')
+		expr = node
+	case *Conditional:
+		b.WriteString("if(")
+		operands, err := children([]Expr{e.Condition, e.Then, e.Else})
+		if err != nil {
+			return nil, shareable{}, err
+		}
+		b.WriteByte(')')
+		expr = &Conditional{Condition: operands[0], Then: operands[1], Else: operands[2]}
+	case *ArrayLiteral:
+		b.WriteByte('[')
+		elements, err := children(e.Elements)
+		if err != nil {
+			return nil, shareable{}, err
+		}
+		b.WriteByte(']')
+		expr = &ArrayLiteral{Elements: elements}
+	case *ObjectLiteral:
+		b.WriteByte('{')
+		for _, key := range e.Keys {
+			b.WriteString(strconv.Quote(key))
+		}
+		b.WriteByte(':')
+		values, err := children(e.Values)
+		if err != nil {
+			return nil, shareable{}, err
+		}
+		b.WriteByte('}')
+		expr = &ObjectLiteral{Keys: e.Keys, Values: values}
+	case *Lambda:
+		node := &Lambda{Param: e.Param}
+		b.WriteString("(" + e.Param + "=>")
+		if node.Body, err = child(e.Body); err != nil {
+			return nil, shareable{}, err
+		}
+		b.WriteByte(')')
+		free = slices.DeleteFunc(free, func(name string) bool { return name == e.Param })
+
+		if !pure {
+			return node, shareable{}, nil
+		}
+
+		// a lambda is only meaningful as an argument, its body is shared instead
+		return node, shareable{key: b.String(), free: free}, nil
+	case *FuncCall:
+		if !PureFunctions[e.Name] {
+			pure = false
+		}
+
+		node := &FuncCall{Name: e.Name, Args: make([]Expr, len(e.Args))}
+		b.WriteString(e.Name + "(")
+		for i, arg := range e.Args {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+
+			before := len(free)
+			if node.Args[i], err = child(arg); err != nil {
+				return nil, shareable{}, err
+			}
+
+			// @ names are bound in the scope the argument is evaluated in
+			if first, ok := scopeArgs[e.Name]; ok && i >= first {
+				free = append(free[:before], slices.DeleteFunc(free[before:], func(name string) bool {
+					return strings.HasPrefix(name, "@")
+				})...)
+			}
+		}
+		b.WriteByte(')')
+		expr = node
+	case *RegexLiteral:
+		return expr, shareable{key: "re" + strconv.Quote(e.Pattern)}, nil
+	default:
+		value, ok := constantValue(expr)
+		if !ok {
+			return expr, shareable{}, nil
+		}
+
+		// constants are not worth sharing but are part of their parent's key
+		return expr, shareable{key: constantKey(value)}, nil
+	}
+
+	if !pure {
+		return expr, shareable{}, nil
+	}
+
+	return s.share(expr, shareable{key: b.String(), free: free}, rewrite), shareable{key: b.String(), free: free}, nil
+}
+
+// visitPath visits an identifier, a path of the document is shared while
+// a binding of a scope is free
+func (s *sharing) visitPath(expr Expr, name string, rewrite bool) (Expr, shareable, error) {
+	path, err := ParsePath(name)
+	if err != nil {
+		return nil, shareable{}, err
+	}
+
+	sub := shareable{key: name}
+
+	// a key other than $ may be a lambda parameter, it is free until the
+	// lambda binding it is visited
+	if key := identKey(path); key != "$" {
+		sub.free = []string{key}
+	}
+
+	if rewrite {
+		if expr, err = newPathExpr(&Ident{Name: name}); err != nil {
+			return nil, shareable{}, err
+		}
+	}
+
+	return s.share(expr, sub, rewrite), sub, nil
+}
+
+// share counts a shareable subexpression, or with rewrite returns the
+// shared node of one counted more than once
+func (s *sharing) share(expr Expr, sub shareable, rewrite bool) Expr {
+	if len(sub.free) > 0 {
+		return expr
+	}
+
+	if !rewrite {
+		s.counts[sub.key]++
+		return expr
+	}
+
+	if s.counts[sub.key] < 2 {
+		return expr
+	}
+
+	node, exists := s.nodes[sub.key]
+	if !exists {
+		node = &sharedExpr{index: len(s.nodes), expr: expr}
+		s.nodes[sub.key] = node
+	}
+
+	return node
+}
+
+// constantKey is the canonical text of a constant
+func constantKey(value any) string {
+	switch v := value.(type) {
+	case string:
+		return strconv.Quote(v)
+	case *big.Float:
+		return "f" + strconv.Itoa(int(v.Prec())) + ":" + v.Text('p', 0)
+	}
+
+	return fmt.Sprintf("%T:%v", value, value)
+}
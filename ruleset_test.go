@@ -0,0 +1,270 @@
+package yap
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+var ruleSetRules = map[string]string{
+	"big order":     `$.type == "order" && $.total > 100`,
+	"small order":   `$.type == "order" && $.total < 10`,
+	"gold":          `$.customer.tier == "gold" && $.type == "order"`,
+	"expensive":     `any($.items, @.price > 50)`,
+	"cheap":         `any($.items, @.price < 5) && $.type == "order"`,
+	"tagged":        `any($.items, contains($.tags, @.name))`,
+	"unbound":       `contains($.tags, @.name)`,
+	"lambda":        `any($.items, i => i.price > $.total / 2)`,
+	"lambda shadow": `any($.items, i => i.price > $.total / 2) && i > 0`,
+	"defaulted":     `($.coupon ?? "none") == "none"`,
+	"coupon":        `$.coupon == "SPRING"`,
+	"total":         `$.total * 2 > 100 ? true : $.total * 2 > 10`,
+	"names":         `length(map($.items, @.name)) > 1`,
+	"now":           `now() > $.createdAt`,
+	"invalid":       `$.type > 1`,
+}
+
+var ruleSetDocuments = []string{
+	`{"type": "order", "total": 120, "customer": {"tier": "gold"}, "tags": ["pen"], "createdAt": "2024-01-01T00:00:00Z",
+	  "items": [{"name": "pen", "price": 2}, {"name": "book", "price": 70}]}`,
+	`{"type": "refund", "total": 5, "coupon": "SPRING", "customer": {"tier": "silver"}, "tags": [], "createdAt": "2024-01-01T00:00:00Z",
+	  "items": [{"name": "cup", "price": 4}]}`,
+	`{"type": "order", "total": 8, "items": []}`,
+}
+
+func newTestRuleSet(t testing.TB) *RuleSet {
+	rules := NewRuleSet()
+	for name, expression := range ruleSetRules {
+		if err := rules.Add(name, expression); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return rules
+}
+
+func TestRuleSetMatchesEvaluators(t *testing.T) {
+	rules := newTestRuleSet(t)
+
+	for _, opts := range [][]EvalOption{
+		nil,
+		{WithMissingKeys(MissingAsUndefined)},
+		{WithMissingKeys(MissingAsNull), WithPrecision(100)},
+	} {
+		for _, document := range ruleSetDocuments {
+			result, err := rules.Eval(document, opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			expect := &RuleSetResult{Matched: []string{}}
+
+			for name, expression := range ruleSetRules {
+				evaluator, err := NewEvaluator(expression)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				value, err := evaluator.Eval(document, opts...)
+				if err != nil {
+					if expect.Errors == nil {
+						expect.Errors = map[string]error{}
+					}
+					expect.Errors[name] = err
+				} else if toBoolean(value) {
+					expect.Matched = append(expect.Matched, name)
+				}
+			}
+			slices.Sort(expect.Matched)
+
+			if fmt.Sprint(result) != fmt.Sprint(expect) {
+				t.Errorf("%s: expected %v, got %v", document, expect, result)
+			}
+		}
+	}
+}
+
+func TestRuleSetSharesSubexpressions(t *testing.T) {
+	rules := NewRuleSet()
+	rules.Add("a", `$.type == "order" && $.total > 10`)
+	rules.Add("b", `$.type == "order" && $.total < 5`)
+	rules.Add("c", `any($.items, @.total > 1) || any($.items, i => i.total > 1)`)
+	rules.Add("d", `any($.items, @.total > 1) || any($.items, i => $.total > 1)`)
+
+	compiled, err := rules.compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// $.type, $.type == "order", $.total, $.items and any($.items, @.total > 1)
+	if compiled.programs.shared != 5 {
+		t.Errorf("expected 5 shared subexpressions, got %d", compiled.programs.shared)
+	}
+
+	rules.Remove("d")
+	if compiled, _ := rules.compile(); compiled.programs.shared != 4 {
+		t.Errorf("expected 4 shared subexpressions after removing a rule, got %d", compiled.programs.shared)
+	}
+}
+
+func TestRuleSetResult(t *testing.T) {
+	rules := newTestRuleSet(t)
+
+	result, err := rules.Eval(ruleSetDocuments[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []string{"big order", "cheap", "defaulted", "expensive", "gold", "lambda", "names", "now", "tagged", "total"}
+	if !slices.Equal(result.Matched, expect) {
+		t.Errorf("expected %q to match, got %q", expect, result.Matched)
+	}
+
+	for _, name := range []string{"unbound", "invalid", "coupon", "lambda shadow"} {
+		if result.Errors[name] == nil {
+			t.Errorf("expected rule %s to fail", name)
+		}
+	}
+
+	if _, err := rules.Eval(`{"type": `); err == nil {
+		t.Errorf("expected an invalid document to fail")
+	}
+
+	if err := rules.Add("broken", `$.type ==`); err == nil {
+		t.Errorf("expected an invalid rule to fail")
+	}
+
+	if rules.Remove("missing") || !rules.Remove("now") {
+		t.Errorf("expected only existing rules to be removed")
+	}
+}
+
+func TestRuleSetConcurrentChanges(t *testing.T) {
+	rules := newTestRuleSet(t)
+
+	var wg sync.WaitGroup
+
+	for i := range 4 {
+		wg.Go(func() {
+			for j := range 200 {
+				name := fmt.Sprintf("rule %d %d", i, j)
+				if err := rules.Add(name, fmt.Sprintf(`$.total > %d`, j)); err != nil {
+					t.Error(err)
+				}
+				if j%2 == 0 {
+					rules.Remove(name)
+				}
+			}
+		})
+
+		wg.Go(func() {
+			for range 200 {
+				result, err := rules.Eval(ruleSetDocuments[i%len(ruleSetDocuments)])
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if len(result.Errors) < 2 {
+					t.Errorf("expected the failing rules, got %v", result.Errors)
+				}
+			}
+		})
+	}
+
+	wg.Wait()
+
+	result, err := rules.Eval(ruleSetDocuments[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// of the rules added concurrently, the odd ones with a bound below 120
+	if expect := 4*60 + 10; len(result.Matched) != expect {
+		t.Errorf("expected %d matches, got %d", expect, len(result.Matched))
+	}
+}
+
+func BenchmarkRuleSet(b *testing.B) {
+	document := ruleSetDocuments[0]
+
+	expressions := make([]string, 1000)
+	for i := range expressions {
+		expressions[i] = fmt.Sprintf(`$.type == "order" && $.customer.tier == "gold" && $.total > %d`, i)
+	}
+
+	b.Run("evaluators", func(b *testing.B) {
+		evaluators := make([]*Evaluator, len(expressions))
+		for i, expression := range expressions {
+			evaluators[i], _ = NewEvaluator(expression)
+		}
+
+		b.ReportAllocs()
+		for b.Loop() {
+			for _, evaluator := range evaluators {
+				if _, err := evaluator.Eval(document); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+
+	b.Run("ruleset", func(b *testing.B) {
+		rules := NewRuleSet()
+		for i, expression := range expressions {
+			rules.Add(strconv.Itoa(i), expression)
+		}
+
+		b.ReportAllocs()
+		for b.Loop() {
+			if _, err := rules.Eval(document); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestRuleSetStepsPerRule(t *testing.T) {
+	rules := NewRuleSet()
+	for name, expression := range map[string]string{
+		"first":   `count($.items, @ > 0) > 0`,
+		"runaway": `count($.items, x => count($.items, @ > x) > 0) > 0`,
+		"second":  `count($.items, @ > 1) > 0`,
+		// heavy runs out of steps in the subexpression it shares with light
+		"heavy": `count($.items, @ > 2) > 0 && count($.items, @ > 3) > 0 && count(filter($.items, @ > 10)) > 0`,
+		"light": `count(filter($.items, @ > 10)) > 0`,
+	} {
+		if err := rules.Add(name, expression); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	items := make([]string, 100)
+	for i := range items {
+		items[i] = strconv.Itoa(i)
+	}
+	data := fmt.Sprintf(`{"items": [%s]}`, strings.Join(items, ","))
+
+	// every rule but the runaway one fits in the steps on its own, not
+	// all of them together
+	result, err := rules.Eval(data, WithMaxSteps(1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(result.Matched, []string{"first", "light", "second"}) {
+		t.Errorf("expected the other rules to match, got %q", result.Matched)
+	}
+
+	for _, name := range []string{"heavy", "runaway"} {
+		var limitErr *LimitError
+		if !errors.As(result.Errors[name], &limitErr) || limitErr.Limit != StepLimit {
+			t.Errorf("expected the %s rule to exceed the steps limit, got %v", name, result.Errors[name])
+		}
+	}
+	if len(result.Errors) != 2 {
+		t.Errorf("expected only the heavy and runaway rules to fail, got %v", result.Errors)
+	}
+}
@@ -0,0 +1,307 @@
+package yap
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"iter"
+	"runtime"
+	"sync"
+)
+
+// Streams evaluate an expression against every record of a reader holding
+// newline delimited JSON or one large JSON array. Records are read one at
+// a time and evaluated by a bounded pool of workers, at most a few records
+// per worker are held in memory however large the input is.
+
+// StreamFormat is the layout of the records of a stream
+type StreamFormat int
+
+const (
+	// DetectFormat reads a JSON array when the input starts with [ and
+	// newline delimited JSON otherwise
+	DetectFormat StreamFormat = iota
+	// NDJSON reads one record per line, blank lines are skipped
+	NDJSON
+	// JSONArray reads the items of a top level array
+	JSONArray
+)
+
+// StreamOrder decides the order results of a stream are emitted in
+type StreamOrder int
+
+const (
+	// Ordered emits results in the order of the records
+	Ordered StreamOrder = iota
+	// Unordered emits results as soon as they are evaluated
+	Unordered
+)
+
+// StreamResult is the evaluation of one record of a stream
+type StreamResult struct {
+	// Index is the position of the record in the stream, starting at 0
+	Index int
+	// Record is the JSON text of the record
+	Record json.RawMessage
+	// Value is the result of the expression
+	Value any
+}
+
+type streamConfig struct {
+	format  StreamFormat
+	order   StreamOrder
+	workers int
+	opts    []EvalOption
+}
+
+// StreamOption configures a stream
+type StreamOption func(config *streamConfig)
+
+// WithFormat sets the layout of the records, the default is DetectFormat
+func WithFormat(format StreamFormat) StreamOption {
+	return func(config *streamConfig) {
+		config.format = format
+	}
+}
+
+// WithOrder sets the order of the results, the default is Ordered
+func WithOrder(order StreamOrder) StreamOption {
+	return func(config *streamConfig) {
+		config.order = order
+	}
+}
+
+// WithWorkers sets the number of records evaluated concurrently, the
+// default is GOMAXPROCS
+func WithWorkers(workers int) StreamOption {
+	return func(config *streamConfig) {
+		config.workers = max(workers, 1)
+	}
+}
+
+// WithEvalOptions sets the options every record is evaluated with
+func WithEvalOptions(opts ...EvalOption) StreamOption {
+	return func(config *streamConfig) {
+		config.opts = opts
+	}
+}
+
+// Stream evaluates the expression against every record of r and yields
+// the results. A record failing to evaluate yields its error and the
+// stream continues, an input that cannot be read further yields a final
+// error. Stopping the iteration waits for the record being read.
+func (e *Evaluator) Stream(r io.Reader, opts ...StreamOption) iter.Seq2[StreamResult, error] {
+	return e.stream(r, false, opts)
+}
+
+// Filter yields the records of r the expression is true for, errors are
+// yielded as by Stream
+func (e *Evaluator) Filter(r io.Reader, opts ...StreamOption) iter.Seq2[StreamResult, error] {
+	return e.stream(r, true, opts)
+}
+
+type streamJob struct {
+	StreamResult
+	err error
+}
+
+func (e *Evaluator) stream(r io.Reader, filter bool, opts []StreamOption) iter.Seq2[StreamResult, error] {
+	config := &streamConfig{workers: runtime.GOMAXPROCS(0)}
+	for _, opt := range opts {
+		opt(config)
+	}
+
+	return func(yield func(StreamResult, error) bool) {
+		var (
+			jobs    = make(chan *streamJob)
+			results = make(chan *streamJob)
+			done    = make(chan struct{})
+			// slots bounds the records read but not yet emitted, including
+			// those waiting for an earlier record in ordered mode
+			slots   = make(chan struct{}, 2*config.workers)
+			workers sync.WaitGroup
+			all     sync.WaitGroup
+			read    int
+			readErr error
+		)
+
+		defer func() {
+			close(done)
+			all.Wait()
+		}()
+
+		all.Go(func() {
+			defer close(jobs)
+
+			readErr = readRecords(r, config.format, func(record json.RawMessage) bool {
+				select {
+				case slots <- struct{}{}:
+				case <-done:
+					return false
+				}
+
+				select {
+				case jobs <- &streamJob{StreamResult: StreamResult{Index: read, Record: record}}:
+					read++
+					return true
+				case <-done:
+					return false
+				}
+			})
+		})
+
+		for range config.workers {
+			workers.Add(1)
+			all.Go(func() {
+				defer workers.Done()
+
+				for job := range jobs {
+					job.Value, job.err = e.evalBytes(job.Record, config.opts)
+
+					select {
+					case results <- job:
+					case <-done:
+						return
+					}
+				}
+			})
+		}
+
+		all.Go(func() {
+			workers.Wait()
+			close(results)
+		})
+
+		emit := func(job *streamJob) bool {
+			<-slots
+
+			if job.err != nil {
+				return yield(job.StreamResult, job.err)
+			}
+			if filter && !toBoolean(job.Value) {
+				return true
+			}
+			return yield(job.StreamResult, nil)
+		}
+
+		pending := map[int]*streamJob{}
+		next := 0
+
+		for job := range results {
+			if config.order == Unordered {
+				if !emit(job) {
+					return
+				}
+				continue
+			}
+
+			pending[job.Index] = job
+			for job, ok := pending[next]; ok; job, ok = pending[next] {
+				delete(pending, next)
+				next++
+				if !emit(job) {
+					return
+				}
+			}
+		}
+
+		// results is closed after the reader finished
+		if readErr != nil {
+			yield(StreamResult{Index: read}, readErr)
+		}
+	}
+}
+
+// readRecords passes each record of r to emit until it returns false
+func readRecords(r io.Reader, format StreamFormat, emit func(record json.RawMessage) bool) error {
+	reader := bufio.NewReader(r)
+
+	if format == DetectFormat {
+		format = NDJSON
+
+		for {
+			b, err := reader.Peek(1)
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			if bytes.ContainsAny(b, " \t\r\n") {
+				reader.Discard(1)
+				continue
+			}
+			if b[0] == '[' {
+				format = JSONArray
+			}
+			break
+		}
+	}
+
+	if format == JSONArray {
+		return readArray(reader, emit)
+	}
+
+	return readLines(reader, emit)
+}
+
+// readLines reads newline delimited records, a line that is not valid JSON
+// is still a record and fails when it is evaluated
+func readLines(reader *bufio.Reader, emit func(record json.RawMessage) bool) error {
+	for {
+		line, err := reader.ReadBytes('\n')
+
+		if record := bytes.TrimSpace(line); len(record) > 0 {
+			if !emit(record) {
+				return nil
+			}
+		}
+
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// readArray reads the items of a top level array
+func readArray(reader *bufio.Reader, emit func(record json.RawMessage) bool) error {
+	decoder := json.NewDecoder(reader)
+
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if token != json.Delim('[') {
+		return errors.New("stream is not a JSON array")
+	}
+
+	for decoder.More() {
+		var record json.RawMessage
+		if err := decoder.Decode(&record); err != nil {
+			return err
+		}
+
+		if !emit(record) {
+			return nil
+		}
+	}
+
+	if _, err := decoder.Token(); err != nil {
+		return err
+	}
+
+	if _, err := decoder.Token(); err != io.EOF {
+		if err != nil {
+			return err
+		}
+		return errors.New("unexpected data after JSON array")
+	}
+
+	return nil
+}
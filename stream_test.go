@@ -0,0 +1,196 @@
+package yap
+
+import (
+	"fmt"
+	"io"
+	"iter"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const streamNDJSON = `{"level": "info", "ms": 12}
+{"level": "error", "ms": 340}
+
+{"level": "warn", "ms": 80}
+not json
+{"level": "error", "ms": 5}
+`
+
+const streamArray = ` [
+	{"level": "info", "ms": 12},
+	{"level": "error", "ms": 340},
+	{"level": "warn", "ms": 80},
+	"not an object",
+	{"level": "error", "ms": 5}
+]`
+
+// collectStream lists the results of a stream as index: value lines
+func collectStream(seq iter.Seq2[StreamResult, error]) []string {
+	lines := []string{}
+	for result, err := range seq {
+		value := encodeResult(result.Value, err)
+		if err == nil && result.Value == nil {
+			value = string(result.Record)
+		}
+		lines = append(lines, fmt.Sprintf("%d: %s", result.Index, value))
+	}
+	return lines
+}
+
+func TestStream(t *testing.T) {
+	evaluator, err := NewEvaluator(`$.level == "error" && $.ms > 100`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	projection, err := NewEvaluator(`{ "level": upper($.level), "slow": $.ms > 50 }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		seq    iter.Seq2[StreamResult, error]
+		expect []string
+	}{
+		{
+			"filter ndjson",
+			evaluator.Filter(strings.NewReader(streamNDJSON)),
+			[]string{
+				`1: true`,
+				`3: error: invalid character 'o' in literal null (expecting 'u')`,
+			},
+		},
+		{
+			"filter array",
+			evaluator.Filter(strings.NewReader(streamArray), WithWorkers(3)),
+			[]string{
+				`1: true`,
+				`3: error: json: cannot unmarshal string into Go value of type map[string]interface {}`,
+			},
+		},
+		{
+			"project array",
+			projection.Stream(strings.NewReader(streamArray), WithFormat(JSONArray), WithWorkers(1)),
+			[]string{
+				`0: {"level":"INFO","slow":false}`,
+				`1: {"level":"ERROR","slow":true}`,
+				`2: {"level":"WARN","slow":true}`,
+				`3: error: json: cannot unmarshal string into Go value of type map[string]interface {}`,
+				`4: {"level":"ERROR","slow":false}`,
+			},
+		},
+		{
+			"eval options",
+			projection.Stream(strings.NewReader(`{"level": "debug"}`), WithEvalOptions(WithMissingKeys(MissingAsUndefined))),
+			[]string{`0: {"level":"DEBUG","slow":false}`},
+		},
+		{
+			"truncated array",
+			evaluator.Filter(strings.NewReader(`[{"level": "error", "ms": 900}, {"level": `)),
+			[]string{`0: true`, `1: error: unexpected EOF`},
+		},
+		{
+			"trailing data",
+			evaluator.Filter(strings.NewReader(`[{"level": "error", "ms": 900}] []`)),
+			[]string{`0: true`, `1: error: unexpected data after JSON array`},
+		},
+		{
+			"not an array",
+			evaluator.Filter(strings.NewReader(`{"level": "error"}`), WithFormat(JSONArray)),
+			[]string{`0: error: stream is not a JSON array`},
+		},
+		{
+			"empty",
+			evaluator.Filter(strings.NewReader(" \n ")),
+			[]string{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lines := collectStream(test.seq)
+			if !slices.Equal(lines, test.expect) {
+				t.Errorf("expected %q, got %q", test.expect, lines)
+			}
+		})
+	}
+}
+
+// records generates NDJSON records without end
+type records struct {
+	next    int
+	pending []byte
+}
+
+func (r *records) Read(p []byte) (int, error) {
+	if len(r.pending) == 0 {
+		r.pending = fmt.Appendf(nil, `{"id": %d, "even": %t}`+"\n", r.next, r.next%2 == 0)
+		r.next++
+	}
+
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+func TestStreamOrder(t *testing.T) {
+	evaluator, err := NewEvaluator(`$.even ? $.id : sum(map([1, 2, 3, 4, 5, 6, 7, 8], @ * 0)) + $.id`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []int
+	for result, err := range evaluator.Stream(io.LimitReader(&records{}, 1<<16), WithWorkers(8)) {
+		if err != nil {
+			continue
+		}
+		ids = append(ids, result.Index)
+		if order, _ := compareNumbers(result.Value, float64(result.Index)); order != 0 {
+			t.Fatalf("record %d yielded %v", result.Index, result.Value)
+		}
+	}
+
+	if len(ids) < 1000 || !slices.IsSorted(ids) {
+		t.Errorf("expected %d ordered results", len(ids))
+	}
+
+	unordered := map[int]bool{}
+	for result, err := range evaluator.Stream(io.LimitReader(&records{}, 1<<16), WithWorkers(8), WithOrder(Unordered)) {
+		if err == nil {
+			unordered[result.Index] = true
+		}
+	}
+
+	if len(unordered) != len(ids) {
+		t.Errorf("expected %d unordered results, got %d", len(ids), len(unordered))
+	}
+}
+
+func TestStreamStops(t *testing.T) {
+	evaluator, err := NewEvaluator(`$.even`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the input never ends, only the records buffered or in flight are read
+	input := &records{}
+	matches := 0
+
+	for result, err := range evaluator.Filter(input, WithWorkers(4)) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Index%2 != 0 {
+			t.Fatalf("record %d does not match", result.Index)
+		}
+		if matches++; matches == 100 {
+			break
+		}
+	}
+
+	if input.next > 1000 {
+		t.Errorf("read %d records to yield 100 matches", input.next)
+	}
+}
@@ -0,0 +1,316 @@
+package yap
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// Times are time.Time values and durations are time.Duration values. Where
+// a time is expected, RFC 3339 strings are accepted as well, so
+// $.createdAt > now() - 24h works on a timestamp of the document. Numbers
+// are not times, epoch milliseconds are converted explicitly with
+// parseTime, e.g. parseTime($.createdAtMillis) > now() - 24h.
+
+// Clock returns the current time, it is injectable for deterministic tests
+type Clock func() time.Time
+
+// WithClock sets the clock used by now(), the default is time.Now
+func WithClock(clock Clock) EvalOption {
+	return func(ctx *EvalContext) {
+		ctx.Clock = clock
+	}
+}
+
+// now returns the current time of the context clock
+func (ctx *EvalContext) now() time.Time {
+	if ctx.Clock == nil {
+		return time.Now()
+	}
+	return ctx.Clock()
+}
+
+// toTime converts a time or an RFC 3339 string
+func toTime(v any) (time.Time, bool) {
+	switch x := v.(type) {
+	case time.Time:
+		return x, true
+	case string:
+		t, err := time.Parse(time.RFC3339Nano, x)
+		return t, err == nil
+	}
+
+	return time.Time{}, false
+}
+
+// isTemporal reports whether v is a time or a duration
+func isTemporal(v any) bool {
+	switch v.(type) {
+	case time.Time, time.Duration:
+		return true
+	}
+	return false
+}
+
+// temporalCompare orders two times or two durations, the other operand of
+// a time may be any value accepted by toTime
+func temporalCompare(left, right any) (int, error) {
+	if lDur, ok := left.(time.Duration); ok {
+		rDur, ok := right.(time.Duration)
+		if !ok {
+			return 0, fmt.Errorf("cannot compare duration with %T", right)
+		}
+		return cmpInt(int64(lDur), int64(rDur)), nil
+	}
+
+	if _, ok := right.(time.Duration); ok {
+		return 0, fmt.Errorf("cannot compare %T with duration", left)
+	}
+
+	lTime, ok := toTime(left)
+	if !ok {
+		return 0, fmt.Errorf("cannot compare %v with a time", left)
+	}
+	rTime, ok := toTime(right)
+	if !ok {
+		return 0, fmt.Errorf("cannot compare %v with a time", right)
+	}
+
+	return lTime.Compare(rTime), nil
+}
+
+func cmpInt(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// temporalArithmetic implements time ± duration, time - time and the
+// arithmetic of durations with each other and with numbers
+func temporalArithmetic(operator string, left, right any) (any, error) {
+	lDur, lIsDur := left.(time.Duration)
+	rDur, rIsDur := right.(time.Duration)
+
+	switch {
+	case lIsDur && rIsDur:
+		switch operator {
+		case "+":
+			return lDur + rDur, nil
+		case "-":
+			return lDur - rDur, nil
+		}
+	case lIsDur || rIsDur:
+		dur, other := lDur, right
+		if rIsDur {
+			dur, other = rDur, left
+		}
+
+		if num, ok := toBigFloat(other); ok {
+			switch {
+			case operator == "*":
+				return scaleDuration(dur, num, false), nil
+			case operator == "/" && lIsDur:
+				if num.Sign() == 0 {
+					return nil, fmt.Errorf("division by zero")
+				}
+				return scaleDuration(dur, num, true), nil
+			}
+		}
+
+		if t, ok := toTime(other); ok {
+			switch {
+			case operator == "+":
+				return t.Add(dur), nil
+			case operator == "-" && rIsDur:
+				return t.Add(-dur), nil
+			}
+		}
+	default:
+		lTime, lOk := toTime(left)
+		rTime, rOk := toTime(right)
+
+		if lOk && rOk && operator == "-" {
+			return lTime.Sub(rTime), nil
+		}
+	}
+
+	return nil, fmt.Errorf("unsupported operands for %s: %T and %T", operator, left, right)
+}
+
+// scaleDuration multiplies or divides a duration by a number
+func scaleDuration(d time.Duration, num *big.Float, divide bool) time.Duration {
+	nanos := new(big.Float).SetInt64(int64(d))
+
+	if divide {
+		nanos.Quo(nanos, num)
+	} else {
+		nanos.Mul(nanos, num)
+	}
+
+	result, _ := nanos.Int64()
+	return time.Duration(result)
+}
+
+// evalTime evaluates a function argument which must be convertible to a time
+func evalTime(ctx *EvalContext, name string, arg Expr) (time.Time, error) {
+	value, err := arg.Eval(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	t, ok := toTime(value)
+	if !ok {
+		return time.Time{}, fmt.Errorf("%s function requires a time argument, got %v", name, value)
+	}
+
+	return t, nil
+}
+
+// evalDuration evaluates a function argument which must be a duration, a
+// duration string such as "1h30m" is accepted as well
+func evalDuration(ctx *EvalContext, name string, arg Expr) (time.Duration, error) {
+	value, err := arg.Eval(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	switch v := value.(type) {
+	case time.Duration:
+		return v, nil
+	case string:
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return 0, fmt.Errorf("%s function: %w", name, err)
+		}
+		return d, nil
+	}
+
+	return 0, fmt.Errorf("%s function requires a duration argument, got %T", name, value)
+}
+
+func init() {
+	registerPureFunctions(timeFunctions)
+	registerFunctions(clockFunctions)
+}
+
+// clockFunctions read the clock of the evaluation, so they are not pure
+var clockFunctions = map[string]Function{
+	"now": func(ctx *EvalContext, args []Expr) (interface{}, error) {
+		if len(args) != 0 {
+			return nil, fmt.Errorf("now function takes no arguments")
+		}
+		return ctx.now(), nil
+	},
+}
+
+var timeFunctions = map[string]Function{
+	// parseTime(value) accepts RFC 3339 strings and epoch milliseconds,
+	// parseTime(str, layout) parses with a Go reference layout
+	"parseTime": func(ctx *EvalContext, args []Expr) (interface{}, error) {
+		if len(args) != 1 && len(args) != 2 {
+			return nil, fmt.Errorf("parseTime function requires 1 or 2 arguments")
+		}
+
+		if len(args) == 1 {
+			value, err := args[0].Eval(ctx)
+			if err != nil {
+				return nil, err
+			}
+
+			if num, ok := toBigFloat(value); ok {
+				millis, _ := num.Int64()
+				return time.UnixMilli(millis).UTC(), nil
+			}
+
+			t, ok := toTime(value)
+			if !ok {
+				return nil, fmt.Errorf("parseTime function requires a time, an RFC 3339 string or epoch milliseconds, got %v", value)
+			}
+			return t, nil
+		}
+
+		strs, err := evalStrings(ctx, "parseTime", args)
+		if err != nil {
+			return nil, err
+		}
+
+		t, err := time.Parse(strs[1], strs[0])
+		if err != nil {
+			return nil, fmt.Errorf("parseTime function: %w", err)
+		}
+		return t, nil
+	},
+
+	// formatTime(t, layout) formats with a Go reference layout, the
+	// layout defaults to RFC 3339
+	"formatTime": func(ctx *EvalContext, args []Expr) (interface{}, error) {
+		if len(args) != 1 && len(args) != 2 {
+			return nil, fmt.Errorf("formatTime function requires 1 or 2 arguments")
+		}
+		t, err := evalTime(ctx, "formatTime", args[0])
+		if err != nil {
+			return nil, err
+		}
+
+		layout := time.RFC3339
+		if len(args) == 2 {
+			if layout, err = evalString(ctx, "formatTime", args[1]); err != nil {
+				return nil, err
+			}
+		}
+
+		return t.Format(layout), nil
+	},
+
+	"addDuration": func(ctx *EvalContext, args []Expr) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, fmt.Errorf("addDuration function requires exactly 2 arguments")
+		}
+		t, err := evalTime(ctx, "addDuration", args[0])
+		if err != nil {
+			return nil, err
+		}
+		d, err := evalDuration(ctx, "addDuration", args[1])
+		if err != nil {
+			return nil, err
+		}
+		return t.Add(d), nil
+	},
+
+	// diff(a, b) is the duration a - b, diff(a, b, unit) the same
+	// expressed as a number of units, e.g. diff(now(), $.createdAt, "d")
+	"diff": func(ctx *EvalContext, args []Expr) (interface{}, error) {
+		if len(args) != 2 && len(args) != 3 {
+			return nil, fmt.Errorf("diff function requires 2 or 3 arguments")
+		}
+		a, err := evalTime(ctx, "diff", args[0])
+		if err != nil {
+			return nil, err
+		}
+		b, err := evalTime(ctx, "diff", args[1])
+		if err != nil {
+			return nil, err
+		}
+
+		d := a.Sub(b)
+		if len(args) == 2 {
+			return d, nil
+		}
+
+		name, err := evalString(ctx, "diff", args[2])
+		if err != nil {
+			return nil, err
+		}
+
+		unit, exists := durationUnits[name]
+		if !exists {
+			return nil, fmt.Errorf("diff function: unknown duration unit: %s", name)
+		}
+
+		return new(big.Float).Quo(new(big.Float).SetInt64(int64(d)), new(big.Float).SetInt64(int64(unit))), nil
+	},
+}
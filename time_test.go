@@ -0,0 +1,65 @@
+package yap
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTime(t *testing.T) {
+	clock := func() time.Time {
+		return time.Date(2024, 5, 17, 12, 0, 0, 0, time.UTC)
+	}
+
+	data := `{
+		"createdAt": "2024-05-17T01:30:00Z",
+		"updatedAt": 1715860800000,
+		"expiresAt": "2024-06-01T00:00:00+02:00"
+	}`
+
+	tests := []evaluateTest{
+		{`now()`, `"2024-05-17T12:00:00Z"`},
+		{`$.createdAt > now() - 24h`, `true`},
+		{`parseTime($.updatedAt) > now() - 24h`, `false`},
+		{`parseTime($.updatedAt) == parseTime("2024-05-16T12:00:00Z")`, `true`},
+		{`formatTime(parseTime(0))`, `"1970-01-01T00:00:00Z"`},
+		{`now() == $.updatedAt`, `false`},
+		{`now() - $.createdAt`, `"10h30m0s"`},
+		{`now() - $.createdAt < 15m`, `false`},
+		{`diff(now(), $.createdAt) > 10h`, `true`},
+		{`diff($.expiresAt, now(), "d")`, `14.416666666666666667`},
+		{`addDuration($.createdAt, "1h30m")`, `"2024-05-17T03:00:00Z"`},
+		{`formatTime(now() + 7d, "2006-01-02")`, `"2024-05-24"`},
+		{`formatTime(parseTime("17/05/2024", "02/01/2006"))`, `"2024-05-17T00:00:00Z"`},
+		{`2 * 1,000ms + 1.5s`, `"3.5s"`},
+		{`now() == null`, `false`},
+	}
+
+	for _, test := range tests {
+		result, err := Evaluate(test.expression, data, WithClock(clock))
+
+		if err != nil {
+			t.Errorf("%s: failed to evaluate: %v", test.expression, err)
+			continue
+		}
+
+		if result != test.expect {
+			t.Errorf("%s: expected %s, got %s", test.expression, test.expect, result)
+		}
+	}
+
+	// numbers are only times when converted with parseTime
+	failures := []string{
+		`now() > 5`,
+		`$.updatedAt > now() - 24h`,
+		`now() - $.updatedAt`,
+		`$.updatedAt + 1h`,
+		`formatTime($.updatedAt)`,
+		`parseTime(true)`,
+	}
+
+	for _, expression := range failures {
+		if _, err := Evaluate(expression, data, WithClock(clock)); err == nil {
+			t.Errorf("%s: expected a number not to be a time", expression)
+		}
+	}
+}
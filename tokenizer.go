@@ -7,22 +7,29 @@ import (
 	"io"
 	"math/big"
 	"strings"
+	"time"
 	"unicode"
 )
 
 // very simple charset
 const (
-	OpenParen   = '('
-	CloseParen  = ')'
-	Comma       = ','
-	Dot         = '.'
-	Equal       = '='
-	Exclamation = '!'
-	LessThan    = '<'
-	GreaterThan = '>'
-	Quote       = '"'
-	Ampersand   = '&'
-	Pipe        = '|'
+	OpenParen    = '('
+	CloseParen   = ')'
+	OpenBrace    = '{'
+	CloseBrace   = '}'
+	OpenBracket  = '['
+	CloseBracket = ']'
+	Colon        = ':'
+	Comma        = ','
+	Dot          = '.'
+	Equal        = '='
+	Exclamation  = '!'
+	LessThan     = '<'
+	GreaterThan  = '>'
+	Quote        = '"'
+	Ampersand    = '&'
+	Pipe         = '|'
+	Question     = '?'
 
 	Multiplication = '*'
 	Addition       = '+'
@@ -39,6 +46,7 @@ const (
 	BinaryOperator                  // 3
 	Punctuation                     // 4
 	WhiteSpace                      // 5
+	Duration                        // 6 - numeric with a time unit
 )
 
 func (tt TokenType) String() string {
@@ -55,6 +63,8 @@ func (tt TokenType) String() string {
 		return "Punctuation"
 	case WhiteSpace:
 		return "WhiteSpace"
+	case Duration:
+		return "Duration"
 	default:
 		return "Unknown"
 	}
@@ -65,6 +75,7 @@ type Token struct {
 	Literal   string
 	Numeric   *big.Float
 	IsDecimal bool
+	Duration  time.Duration
 }
 
 func (t *Token) String() string {
@@ -73,6 +84,17 @@ func (t *Token) String() string {
 
 type Tokenizer struct {
 	reader *bufio.Reader
+	// lists tells for each open parenthesis, bracket and brace whether it
+	// opens a list of arguments, items or entries, in which commas
+	// separate the list. A grouping parenthesis keeps the outer context.
+	lists []bool
+	// previous is the last token read other than whitespace
+	previous *Token
+}
+
+// inList reports whether a comma separates a list at the current position
+func (t *Tokenizer) inList() bool {
+	return len(t.lists) > 0 && t.lists[len(t.lists)-1]
 }
 
 func (t *Tokenizer) ReadString() (string, error) {
@@ -161,6 +183,31 @@ func (t *Tokenizer) readConditional(op rune) (*Token, error) {
 	}, nil
 }
 
+// readQuestion reads the coalesce operator '??' or a lone '?'
+func (t *Tokenizer) readQuestion() (*Token, error) {
+	second, _, err := t.reader.ReadRune()
+
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	if err == nil && second == Question {
+		return &Token{
+			Type:    BinaryOperator,
+			Literal: "??",
+		}, nil
+	}
+
+	if err == nil {
+		t.reader.UnreadRune()
+	}
+
+	return &Token{
+		Type:    Punctuation,
+		Literal: string(Question),
+	}, nil
+}
+
 func (t *Tokenizer) readEquality(op rune) (*Token, error) {
 	second, _, err := t.reader.ReadRune()
 
@@ -179,12 +226,31 @@ func (t *Tokenizer) readEquality(op rune) (*Token, error) {
 		return nil, err
 	}
 
-	// weird syntax like '=>' or '=<' or '=!'
+	// lambda arrow, e.g. o => o.total
+	if op == '=' && second == '>' {
+		return &Token{
+			Literal: "=>",
+			Type:    Punctuation,
+		}, nil
+	}
+
+	// regular expression match, e.g. $.name =~ "^b" or $.name !~ "^b"
+	if (op == '=' || op == '!') && second == '~' {
+		return &Token{
+			Literal: string(op) + "~",
+			Type:    BinaryOperator,
+		}, nil
+	}
+
+	// weird syntax like '=<' or '=!'
 	if op == '=' && second != '=' {
 		return nil, errors.New("unsupported equality operation")
 	}
 
 	if op != '=' && second != '=' {
+		// the second rune belongs to the next token, e.g. '>5'
+		t.reader.UnreadRune()
+
 		return &Token{
 			Literal: string(op),
 			Type:    BinaryOperator,
@@ -194,7 +260,7 @@ func (t *Tokenizer) readEquality(op rune) (*Token, error) {
 	// validate the third rune is not '=', ('===' or '>==', '<==') etc.
 	third, _, err := t.reader.ReadRune()
 
-	if err != nil {
+	if err != nil && err != io.EOF {
 		return nil, err
 	}
 
@@ -202,6 +268,10 @@ func (t *Tokenizer) readEquality(op rune) (*Token, error) {
 		return nil, errors.New("unsupported equality operation")
 	}
 
+	if err == nil {
+		t.reader.UnreadRune()
+	}
+
 	return &Token{
 		Literal: string(op) + "=",
 		Type:    BinaryOperator,
@@ -218,6 +288,16 @@ func (t *Tokenizer) readNumeric() (*Token, error) {
 	isDecimal := false
 
 	for {
+		// a comma not followed by a group of three digits is
+		// punctuation, e.g. the argument separator in f(1, 2). Within a
+		// list a comma followed by one is ambiguous, f(1,000) may be
+		// meant as f(1, 0) or f(1000).
+		if comma, group := t.peekComma(); comma && !group {
+			break
+		} else if comma && t.inList() {
+			return nil, errors.New("ambiguous comma in a numeric within a list, use '_' to group digits or ', ' to separate items")
+		}
+
 		c, _, err := t.reader.ReadRune()
 
 		if err == io.EOF {
@@ -267,6 +347,27 @@ func (t *Tokenizer) readNumeric() (*Token, error) {
 		return nil, errors.New("failed to parse float")
 	}
 
+	unit, err := t.readDurationUnit()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if unit != "" {
+		scale, exists := durationUnits[unit]
+		if !exists {
+			return nil, fmt.Errorf("unknown duration unit: %s", unit)
+		}
+
+		nanos, _ := new(big.Float).Mul(f, new(big.Float).SetInt64(int64(scale))).Int64()
+
+		return &Token{
+			Type:     Duration,
+			Literal:  literal.String() + unit,
+			Duration: time.Duration(nanos),
+		}, nil
+	}
+
 	return &Token{
 		Type:      Numeric,
 		Numeric:   f,
@@ -276,10 +377,73 @@ func (t *Tokenizer) readNumeric() (*Token, error) {
 
 }
 
+// durationUnits are the suffixes of duration literals, e.g. 15m or 7d
+var durationUnits = map[string]time.Duration{
+	"ms": time.Millisecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
+	"d":  24 * time.Hour,
+	"w":  7 * 24 * time.Hour,
+}
+
+// readDurationUnit reads the letters directly following a numeric
+func (t *Tokenizer) readDurationUnit() (string, error) {
+	var unit strings.Builder
+
+	for {
+		c, _, err := t.reader.ReadRune()
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return "", err
+		}
+
+		if !unicode.IsLetter(c) {
+			t.reader.UnreadRune()
+			break
+		}
+
+		unit.WriteRune(c)
+	}
+
+	return unit.String(), nil
+}
+
+// peekComma reports whether the next rune is a comma and whether it is
+// followed by a group of exactly three digits, i.e. it may separate
+// thousands.
+func (t *Tokenizer) peekComma() (comma bool, group bool) {
+	peek, _ := t.reader.Peek(5)
+
+	if len(peek) == 0 || peek[0] != ',' {
+		return false, false
+	}
+
+	if len(peek) < 4 {
+		return true, false
+	}
+
+	for _, b := range peek[1:4] {
+		if b < '0' || b > '9' {
+			return true, false
+		}
+	}
+
+	return true, len(peek) == 4 || peek[4] < '0' || peek[4] > '9'
+}
+
 func (t *Tokenizer) readIdentifier(first rune) (*Token, error) {
 	var literal strings.Builder
 	literal.WriteRune(first)
 
+	// track open brackets so a trailing ']' closing an array
+	// literal is not swallowed, e.g. [$.a, $.b]
+	depth := 0
+
 	for {
 		c, _, err := t.reader.ReadRune()
 
@@ -291,6 +455,18 @@ func (t *Tokenizer) readIdentifier(first rune) (*Token, error) {
 			return nil, err
 		}
 
+		if c == '[' {
+			depth++
+		}
+
+		if c == ']' {
+			if depth == 0 {
+				t.reader.UnreadRune()
+				break
+			}
+			depth--
+		}
+
 		if t.isIdentifierPart(c) {
 			literal.WriteRune(c)
 		} else {
@@ -314,6 +490,16 @@ func (t *Tokenizer) isIdentifierPart(r rune) bool {
 }
 
 func (t *Tokenizer) ReadToken() (*Token, error) {
+	token, err := t.readToken()
+
+	if err == nil && token.Type != WhiteSpace {
+		t.previous = token
+	}
+
+	return token, err
+}
+
+func (t *Tokenizer) readToken() (*Token, error) {
 	r, _, err := t.reader.ReadRune()
 
 	if err != nil {
@@ -321,8 +507,21 @@ func (t *Tokenizer) ReadToken() (*Token, error) {
 	}
 
 	switch r {
-	case OpenParen, CloseParen, Comma:
+	case OpenParen, CloseParen, OpenBrace, CloseBrace, OpenBracket, CloseBracket, Colon, Comma:
 		{
+			switch r {
+			case OpenParen:
+				// a parenthesis after a function name opens its arguments
+				call := t.previous != nil && t.previous.Type == Identifier
+				t.lists = append(t.lists, call || t.inList())
+			case OpenBrace, OpenBracket:
+				t.lists = append(t.lists, true)
+			case CloseParen, CloseBrace, CloseBracket:
+				if len(t.lists) > 0 {
+					t.lists = t.lists[:len(t.lists)-1]
+				}
+			}
+
 			return &Token{
 				Type:    Punctuation,
 				Literal: string(r),
@@ -336,6 +535,10 @@ func (t *Tokenizer) ReadToken() (*Token, error) {
 		{
 			return t.readConditional(r)
 		}
+	case Question:
+		{
+			return t.readQuestion()
+		}
 	case Multiplication, Addition, Subtraction, Division:
 		{
 			return &Token{
@@ -379,7 +582,7 @@ func (t *Tokenizer) ReadToken() (*Token, error) {
 			}
 
 			// unrecognized token
-			return &Token{}, nil
+			return nil, fmt.Errorf("unexpected character: %q", r)
 		}
 	}
 }
@@ -4,6 +4,7 @@ import (
 	"math/big"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestReadString(t *testing.T) {
@@ -169,3 +170,80 @@ func TestReadIdentifier(t *testing.T) {
 		t.Logf("got: %s, expected: %s", expect, token.Literal)
 	}
 }
+
+func TestReadNumericArguments(t *testing.T) {
+	tests := map[string][]string{
+		`f(1,2, 1_000)`:                 {"f", "(", "1", ",", "2", ",", "1_000", ")"},
+		`[100, 200,30]`:                 {"[", "100", ",", "200", ",", "30", "]"},
+		`[1] == 1,000`:                  {"[", "1", "]", "==", "1,000"},
+		`($.a > 1,000)`:                 {"(", "$.a", ">", "1,000", ")"},
+		`(($.a >= 1,000,000) || $.b)`:   {"(", "(", "$.a", ">=", "1,000,000", ")", "||", "$.b", ")"},
+		`f(g(1), 2) == (1,000)`:         {"f", "(", "g", "(", "1", ")", ",", "2", ")", "==", "(", "1,000", ")"},
+		`max (1_000, (2)) < 1,000 * 60`: {"max", "(", "1_000", ",", "(", "2", ")", ")", "<", "1,000", "*", "60"},
+	}
+
+	for test, expect := range tests {
+		tokens, err := Tokenize(strings.NewReader(test))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(tokens) != len(expect) {
+			t.Errorf("%s: expected %d tokens, got %d", test, len(expect), len(tokens))
+			continue
+		}
+
+		for i, token := range tokens {
+			if token.Literal != expect[i] {
+				t.Errorf("%s: expected token %d to be %s, got %s", test, i, expect[i], token.Literal)
+			}
+		}
+	}
+}
+
+func TestReadAmbiguousNumericInList(t *testing.T) {
+	for _, test := range []string{`[100,200,300]`, `max(1,000, 2)`, `if(true, 1,000, 2)`, `{"a": 1,000}`, `f((1,000))`} {
+		if _, err := Tokenize(strings.NewReader(test)); err == nil {
+			t.Errorf("%s: expected the comma to be ambiguous", test)
+		}
+	}
+}
+
+func TestReadConstructorPunctuation(t *testing.T) {
+	tokens, err := Tokenize(strings.NewReader(`{"a": [$.b[0], $.c]}`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []string{"{", "a", ":", "[", "$.b[0]", ",", "$.c", "]", "}"}
+
+	if len(tokens) != len(expect) {
+		t.Fatalf("expected %d tokens, got %d", len(expect), len(tokens))
+	}
+
+	for i, token := range tokens {
+		if token.Literal != expect[i] {
+			t.Errorf("expected token %d to be %s, got %s", i, expect[i], token.Literal)
+		}
+	}
+}
+
+func TestReadDuration(t *testing.T) {
+	tokenizer := NewTokenizer(strings.NewReader(`1.5h `))
+
+	token, err := tokenizer.ReadToken()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if token.Type != Duration || token.Duration != 90*time.Minute {
+		t.Errorf("expected a 1h30m duration, got %s %v", token.Type, token.Duration)
+	}
+
+	if _, err := Tokenize(strings.NewReader(`5parsecs`)); err == nil {
+		t.Errorf("expected unknown duration unit to fail")
+	}
+}
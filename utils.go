@@ -1,7 +1,60 @@
 package yap
 
-import "math/big"
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+)
 
 func NewFloatFromInt(i int) *big.Float {
 	return new(big.Float).SetInt(big.NewInt(int64(i)))
 }
+
+func toBigFloat(i interface{}) (*big.Float, bool) {
+	return bigNumber(new(big.Float), i)
+}
+
+func toBoolean(v interface{}) bool {
+	switch x := v.(type) {
+	case bool:
+		// already truthy
+		return x
+	case string:
+		b, err := strconv.ParseBool(x)
+
+		if err != nil {
+			return false
+		}
+		return b
+	case int:
+		return x > 0
+	case int64:
+		return x > 0
+	case int53:
+		return x > 0
+	case float64:
+		return x > 0.0
+	case *big.Float:
+		return x.Cmp(big.NewFloat(0)) == 1
+	}
+
+	return false
+}
+
+// keyString converts a value into an object key
+func keyString(v any) (string, error) {
+	switch x := v.(type) {
+	case string:
+		return x, nil
+	case bool:
+		return strconv.FormatBool(x), nil
+	case nil:
+		return "null", nil
+	}
+
+	if num, ok := toBigFloat(v); ok {
+		return num.Text('g', -1), nil
+	}
+
+	return "", fmt.Errorf("cannot use %T as a key", v)
+}
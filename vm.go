@@ -0,0 +1,170 @@
+package yap
+
+import (
+	"strings"
+)
+
+// stackBuffer is the stack size available without allocating, programs
+// needing a deeper stack allocate it on the heap
+const stackBuffer = 16
+
+// Eval runs the program, it gives the same results as evaluating the tree
+// it was compiled from
+func (p *program) Eval(ctx *EvalContext) (interface{}, error) {
+	var buffer [stackBuffer]any
+	stack := buffer[:0]
+	if p.stackSize > stackBuffer {
+		stack = make([]any, 0, p.stackSize)
+	}
+
+	// contexts replaced by opLenient, restored by opRestore
+	var saved []*EvalContext
+
+	counted := ctx.steps != nil
+
+	code := p.code
+	for pc := 0; pc < len(code); {
+		in := code[pc]
+		pc++
+
+		if counted {
+			if err := ctx.step(); err != nil {
+				return nil, err
+			}
+		}
+
+		switch in.op {
+		case opConst:
+			stack = append(stack, p.consts[in.arg])
+		case opPath:
+			value, err := p.paths[in.arg].Eval(ctx)
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, value)
+		case opBinary:
+			n := len(stack)
+			left, right := stack[n-2], stack[n-1]
+
+			result, ok := fastBinary(ctx, p.binOps[in.arg].Operator, left, right)
+			if !ok {
+				var err error
+				if result, err = p.binOps[in.arg].apply(ctx, left, right); err != nil {
+					return nil, err
+				}
+			}
+
+			stack[n-2] = result
+			stack = stack[:n-1]
+		case opUnary:
+			n := len(stack)
+			result, err := p.unaryOps[in.arg].apply(ctx, stack[n-1])
+			if err != nil {
+				return nil, err
+			}
+			stack[n-1] = result
+		case opJump:
+			pc = int(in.arg)
+		case opJumpIfFalse:
+			n := len(stack)
+			condition := stack[n-1]
+			stack = stack[:n-1]
+
+			if !toBoolean(condition) {
+				pc = int(in.arg)
+			}
+		case opAnd, opOr:
+			n := len(stack)
+			truthy := toBoolean(stack[n-1])
+
+			if truthy == (in.op == opOr) {
+				stack[n-1] = truthy
+				pc = int(in.arg)
+			} else {
+				stack = stack[:n-1]
+			}
+		case opBool:
+			n := len(stack)
+			stack[n-1] = toBoolean(stack[n-1])
+		case opCoalesce:
+			n := len(stack)
+			if isAbsent(stack[n-1]) {
+				stack = stack[:n-1]
+			} else {
+				pc = int(in.arg)
+			}
+		case opLenient:
+			saved = append(saved, ctx)
+			ctx = lenient(ctx)
+		case opRestore:
+			ctx = saved[len(saved)-1]
+			saved = saved[:len(saved)-1]
+		case opArray:
+			n := len(stack) - int(in.arg)
+			values := make([]any, in.arg)
+			copy(values, stack[n:])
+
+			stack = append(stack[:n], values)
+		case opObject:
+			keys := p.objects[in.arg]
+			n := len(stack) - len(keys)
+			object := make(map[string]any, len(keys))
+
+			// missing values are left out of the object
+			for i, key := range keys {
+				if value := stack[n+i]; value != Undefined {
+					object[key] = value
+				}
+			}
+
+			stack = append(stack[:n], object)
+		case opCall:
+			result, err := p.calls[in.arg].Eval(ctx)
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, result)
+		case opEval:
+			result, err := p.nodes[in.arg].Eval(ctx)
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, result)
+		}
+	}
+
+	return stack[0], nil
+}
+
+// fastBinary computes comparisons of two numbers or two strings without
+// converting the operands, ok is false when BinOp.apply is needed
+func fastBinary(ctx *EvalContext, operator string, left, right any) (result any, ok bool) {
+	var c int
+
+	if lStr, isStr := left.(string); isStr {
+		rStr, isStr := right.(string)
+		if !isStr || ctx.Collation != nil {
+			return nil, false
+		}
+		c = strings.Compare(lStr, rStr)
+	} else if c, ok = compareNumbers(left, right); !ok {
+		return nil, false
+	}
+
+	switch operator {
+	case "==":
+		return c == 0, true
+	case "!=":
+		return c != 0, true
+	case "<":
+		return c < 0, true
+	case ">":
+		return c > 0, true
+	case "<=":
+		return c <= 0, true
+	case ">=":
+		return c >= 0, true
+	}
+
+	return nil, false
+}
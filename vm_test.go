@@ -0,0 +1,182 @@
+package yap
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+const vmJson = `{
+	"threshold": 10,
+	"name": "Ada",
+	"tags": ["a", "b"],
+	"user": {"age": 36, "email": null, "createdAt": "2024-01-02T03:04:05Z"},
+	"items": [
+		{"name": "c", "v": 12, "kind": "x"},
+		{"name": "a", "v": 4, "kind": "y"},
+		{"name": "b", "v": 20, "kind": "x"}
+	]
+}`
+
+var vmExpressions = []string{
+	`$.threshold > 5 && $.name == "Ada"`,
+	`$.threshold < 5 || $.name != "Ada"`,
+	`$.threshold >= 10.0 && $.threshold <= 10`,
+	`$.threshold * 2 + 1 - 3 / 4`,
+	`-$.threshold`,
+	`!$.user.email`,
+	`$.name + " Lovelace"`,
+	`$.user.email ?? $.name`,
+	`$.user.phone ?? ($.missing ?? "none")`,
+	`$.threshold > 5 ? "big" : "small"`,
+	`$.threshold > 50 ? "big" : $.threshold > 5 ? "medium" : "small"`,
+	`[$.name, $.threshold, [true, null], {}]`,
+	`{ "n": $.name, "missing": $.nope ?? $.nope, "n": "last" }`,
+	`$.tags[1] == "b" && $.items[0].v == 12`,
+	`$.tags == ["a", "b"]`,
+	`$.name =~ "^A" && $.name !~ "z"`,
+	`$.user.createdAt < now() && now() - 24h > $.user.createdAt`,
+	`map(filter($.items, @.v > $.threshold), i => { "name": i.name, "double": i.v * 2 })`,
+	`reduce($.items, 0, @acc + @.v)`,
+	`map(sortBy($.items, @.name), @.name)`,
+	`count($.items, x => any($.tags, x.name == @))`,
+	`length($.name) > 2 ? upper($.name) : lower($.name)`,
+	`"1" < 2`,
+	`$.threshold / 0`,
+	`$.missing > 1`,
+	`@.name`,
+	`x => x`,
+	`nope(1)`,
+}
+
+// evalBoth evaluates an expression with the tree walker and the VM
+func evalBoth(expression, data string, opts ...EvalOption) (walked, compiled string, err error) {
+	evaluator, err := NewEvaluator(expression)
+	if err != nil {
+		return "", "", err
+	}
+
+	var js any
+	if err := json.Unmarshal([]byte(data), &js); err != nil {
+		return "", "", err
+	}
+
+	walked = encodeResult(evaluator.expression.Eval(newEvalContext(js, opts)))
+	compiled = encodeResult(evaluator.program.Eval(newEvalContext(js, opts)))
+	return walked, compiled, nil
+}
+
+// encodeResult encodes an evaluation result or its error for comparison
+func encodeResult(result any, err error) string {
+	if err != nil {
+		return "error: " + err.Error()
+	}
+
+	encoded, err := json.Marshal(toJSONValue(result))
+	if err != nil {
+		return "error: " + err.Error()
+	}
+	return string(encoded)
+}
+
+func TestVMMatchesTreeWalker(t *testing.T) {
+	modes := map[string][]EvalOption{
+		"default":   nil,
+		"undefined": {WithMissingKeys(MissingAsUndefined)},
+		"lenient":   {WithComparison(LenientComparison), WithMissingKeys(MissingAsNull)},
+	}
+
+	for mode, opts := range modes {
+		for _, expression := range vmExpressions {
+			walked, compiled, err := evalBoth(expression, vmJson, opts...)
+			if err != nil {
+				t.Fatalf("%s: %v", expression, err)
+			}
+
+			if walked != compiled {
+				t.Errorf("%s (%s): tree walker gave %s, VM gave %s", expression, mode, walked, compiled)
+			}
+		}
+	}
+}
+
+func TestCompileStackSize(t *testing.T) {
+	expressions := map[string]int{
+		`1`:                        1,
+		`1 + 2 * 3`:                3,
+		`[1, 2, 3, 4]`:             4,
+		`$.a ? 1 : [2, 3]`:         2,
+		`$.a && ($.b || $.c == 1)`: 2,
+	}
+
+	for expression, expect := range expressions {
+		evaluator, err := NewEvaluator(expression)
+		if err != nil {
+			t.Fatalf("%s: %v", expression, err)
+		}
+
+		if evaluator.program.stackSize != expect {
+			t.Errorf("%s: expected stack size %d, got %d", expression, expect, evaluator.program.stackSize)
+		}
+	}
+}
+
+func TestVMDeepStack(t *testing.T) {
+	elements := "0"
+	for i := 1; i < 3*stackBuffer; i++ {
+		elements += fmt.Sprintf(", %d", i)
+	}
+
+	result, err := Evaluate(fmt.Sprintf("length([%s])", elements), "{}")
+	if err != nil {
+		t.Fatalf("failed to evaluate: %v", err)
+	}
+
+	if expect := fmt.Sprint(3 * stackBuffer); result != expect {
+		t.Errorf("expected %s, got %s", expect, result)
+	}
+}
+
+var benchmarkExpressions = map[string]string{
+	"comparison":  `$.threshold > 5 && $.name == "Ada" && $.user.age >= 18`,
+	"arithmetic":  `$.threshold * 2 + $.user.age / 4 > 20`,
+	"conditional": `$.user.email ?? ($.threshold > 5 ? "big" : "small")`,
+	"functions":   `count(filter($.items, @.v > $.threshold)) == 2`,
+}
+
+func benchmarkEvaluator(b *testing.B, eval func(*Evaluator, *EvalContext) (any, error)) {
+	var js any
+	if err := json.Unmarshal([]byte(vmJson), &js); err != nil {
+		b.Fatal(err)
+	}
+
+	for name, expression := range benchmarkExpressions {
+		evaluator, err := NewEvaluator(expression)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		b.Run(name, func(b *testing.B) {
+			ctx := newEvalContext(js, nil)
+			b.ReportAllocs()
+
+			for b.Loop() {
+				if _, err := eval(evaluator, ctx); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkTreeWalker(b *testing.B) {
+	benchmarkEvaluator(b, func(e *Evaluator, ctx *EvalContext) (any, error) {
+		return e.expression.Eval(ctx)
+	})
+}
+
+func BenchmarkVM(b *testing.B) {
+	benchmarkEvaluator(b, func(e *Evaluator, ctx *EvalContext) (any, error) {
+		return e.program.Eval(ctx)
+	})
+}